@@ -1,30 +1,70 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
 	"github.com/s0n1cAK/yandex-metrics/internal/logger"
 	"github.com/s0n1cAK/yandex-metrics/internal/service/agent"
 	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
 	"go.uber.org/zap"
 )
 
+// Коды завершения агента
+const (
+	// exitOK - штатная остановка по сигналу
+	exitOK = 0
+	// exitFatal - агент не смог запуститься или завершился с ошибкой
+	exitFatal = 1
+	// exitFinalReport - агент остановлен, но последний отчет не был отправлен
+	exitFinalReport = 2
+)
+
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
 	log, err := logger.NewLogger()
 	if err != nil {
-		log.Fatal("failed to init logger", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "failed to init logger: %s \n", err)
+		return exitFatal
 	}
 	defer log.Sync()
 
+	appCtx, appCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer appCancel()
+
 	metricsStorage := memstorage.New()
 
-	agent := agent.New(log, metricsStorage)
+	metricsAgent, err := agent.New(log, metricsStorage)
+	if err != nil {
+		log.Error("failed to create agent", zap.Error(err))
+		return exitFatal
+	}
 
 	log.Info("Agent started",
-		zap.String("endpoint", agent.Server),
-		zap.Duration("poll_interval", agent.PollInterval),
-		zap.Duration("report_interval", agent.ReportInterval),
+		zap.String("version", identity.Version),
+		zap.String("endpoint", metricsAgent.Server),
+		zap.Duration("poll_interval", metricsAgent.PollInterval),
+		zap.Duration("report_interval", metricsAgent.ReportInterval),
 	)
-	err = agent.Run()
-	if err != nil {
-		log.Fatal("Error: %w \n", zap.Error(err))
+
+	err = metricsAgent.Run(appCtx)
+	switch {
+	case err == nil:
+		log.Info("Agent stopped")
+		return exitOK
+	case errors.Is(err, agent.ErrFinalReport):
+		log.Error("Agent stopped without final report", zap.Error(err))
+		return exitFinalReport
+	default:
+		log.Error("Agent failed", zap.Error(err))
+		return exitFatal
 	}
 }
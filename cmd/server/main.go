@@ -16,17 +16,26 @@ import (
 )
 
 func main() {
-	log, err := logger.NewLogger()
+	log, level, err := logger.New()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to init logger: %s \n", err)
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "tokens" {
+		if err := runTokens(context.Background(), os.Args[2:], os.Stdout, log); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := config.NewConfig(log)
 	if err != nil {
 		log.Fatal("failed to create server config", zap.Error(err))
 	}
 	defer cfg.Logger.Sync()
+	cfg.LogLevel = &level
 
 	appCtx, appCancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer appCancel()
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/server"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+const tokensUsage = `usage:
+  server tokens create --name NAME --scopes read,write [--tenant TENANT] [--token-store PATH|postgres]
+  server tokens revoke ID
+  server tokens list`
+
+var errTokensUsage = errors.New(tokensUsage)
+
+// runTokens выполняет подкоманду tokens: create, revoke или list.
+// Хранилище выбирается тем же --token-store (TOKEN_STORE), что и у сервера.
+func runTokens(ctx context.Context, args []string, out io.Writer, log *zap.Logger) error {
+	op := "tokens"
+
+	fs := pflag.NewFlagSet("tokens", pflag.ContinueOnError)
+	name := fs.String("name", "", "Token name, e.g. agent or grafana")
+	scopes := fs.String("scopes", string(tokens.ScopeRead), "Comma-separated scopes: read, write, admin")
+	tenantName := fs.String("tenant", tenant.Default, "Tenant the token is restricted to, empty for the default tenant")
+
+	cfg, err := config.LoadConfig(fs, args, log)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if cfg.TokenStore == "" {
+		return fmt.Errorf("%s: --token-store or TOKEN_STORE is required", op)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	store, err := tokens.Open(ctx, cfg.TokenStore, cfg.DSN)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	cmd := fs.Args()
+	if len(cmd) == 0 {
+		return errTokensUsage
+	}
+
+	switch cmd[0] {
+	case "create":
+		parsed, err := tokens.ParseScopes(*scopes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := tenant.Validate(*tenantName); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		value, token, err := tokens.Generate(*name, parsed)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		token.Tenant = *tenantName
+		if err := store.Create(ctx, token); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		// Значение выводится только здесь, в хранилище остается лишь его хеш
+		fmt.Fprintf(out, "id: %s\ntoken: %s\n", token.ID, value)
+	case "revoke":
+		if len(cmd) != 2 {
+			return errTokensUsage
+		}
+		if err := store.Revoke(ctx, cmd[1]); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		fmt.Fprintf(out, "revoked: %s\n", cmd[1])
+	case "list":
+		list, err := store.List(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		printTokens(out, list)
+	default:
+		return errTokensUsage
+	}
+
+	return nil
+}
+
+func printTokens(out io.Writer, list []tokens.Token) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTENANT\tSCOPES\tCREATED\tREVOKED")
+	for _, t := range list {
+		scopes := make([]string, len(t.Scopes))
+		for i, s := range t.Scopes {
+			scopes[i] = string(s)
+		}
+		revoked := "-"
+		if t.Revoked() {
+			revoked = t.RevokedAt.Format(time.RFC3339)
+		}
+		tenantName := t.Tenant
+		if tenantName == tenant.Default {
+			tenantName = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.ID, t.Name, tenantName, strings.Join(scopes, ","), t.CreatedAt.Format(time.RFC3339), revoked)
+	}
+	w.Flush()
+}
@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
+	"github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+)
+
+// NewEvent создает событие аудита о запросе с адреса ip: арендатор, агент, сертификат и токен берутся из ctx.
+func NewEvent(ctx context.Context, ip string) model.AuditEvent {
+	event := model.AuditEvent{
+		TS:        time.Now().Unix(),
+		IPAddress: ip,
+		Tenant:    tenant.FromContext(ctx),
+	}
+	if id, ok := identity.FromContext(ctx); ok {
+		event.AgentID = id.ID
+		event.Hostname = id.Hostname
+	}
+	// Сертификат подтверждает клиента надежнее адреса, который может быть адресом прокси
+	if peer, ok := identity.PeerFromContext(ctx); ok {
+		event.ClientCert = peer
+		event.IPAddress = ""
+	}
+	if token, ok := tokens.FromContext(ctx); ok {
+		event.TokenID = token.ID
+		event.TokenName = token.Name
+	}
+	return event
+}
@@ -39,5 +39,8 @@ func (f *FileAuditObserver) Notify(event model.AuditEvent) error {
 	}
 
 	return nil
+}
 
+func (f *FileAuditObserver) String() string {
+	return "file:" + f.path
 }
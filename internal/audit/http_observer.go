@@ -3,17 +3,24 @@ package audit
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/s0n1cAK/yandex-metrics/internal/model"
 )
 
+// httpAuditTimeout ограничивает отправку события, чтобы зависший приемник не останавливал свою очередь
+const httpAuditTimeout = 10 * time.Second
+
 type HTTPAuditObserver struct {
-	url string
+	url    string
+	client *http.Client
 }
 
 func NewHTTPAuditObserver(url string) *HTTPAuditObserver {
-	return &HTTPAuditObserver{url: url}
+	return &HTTPAuditObserver{url: url, client: &http.Client{Timeout: httpAuditTimeout}}
 }
 
 func (h *HTTPAuditObserver) Notify(event model.AuditEvent) error {
@@ -22,11 +29,30 @@ func (h *HTTPAuditObserver) Notify(event model.AuditEvent) error {
 		return err
 	}
 
-	resp, err := http.Post(h.url, "application/json", bytes.NewBuffer(data))
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("audit endpoint responded %s", resp.Status)
+	}
 	return nil
 }
+
+// Key возвращает полный адрес приемника: адреса с разными параметрами - разные приемники.
+func (h *HTTPAuditObserver) Key() string {
+	return "http:" + h.url
+}
+
+// String возвращает адрес приемника без учетных данных.
+func (h *HTTPAuditObserver) String() string {
+	u, err := url.Parse(h.url)
+	if err != nil {
+		return "http"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return "http:" + u.String()
+}
@@ -1,21 +1,235 @@
 package audit
 
-import "github.com/s0n1cAK/yandex-metrics/internal/model"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 
+	"github.com/s0n1cAK/yandex-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// OverflowPolicy - что делать с событием, если очередь приемника заполнена.
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest вытесняет самое старое событие очереди
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowBlock ждет места в очереди, задерживая запрос
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowSpill дописывает событие в файл, который приемник дочитает, когда разберет очередь
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+var (
+	DefaultQueueSize = 1024
+	DefaultOverflow  = OverflowDropOldest
+)
+
+var (
+	ErrClosed      = errors.New("audit publisher is closed")
+	ErrBadOverflow = errors.New("audit overflow must be one of drop_oldest, block, spill")
+	ErrNoSpillDir  = errors.New("audit spill directory is required for spill overflow")
+	ErrDuplicate   = errors.New("audit observer is already registered")
+)
+
+// Options - настройки очередей AuditPublisher.
+type Options struct {
+	// QueueSize - емкость очереди каждого приемника, 0 - DefaultQueueSize
+	QueueSize int
+	// Overflow - поведение при заполненной очереди, пустое - DefaultOverflow
+	Overflow OverflowPolicy
+	// SpillDir - каталог файлов OverflowSpill, в нем же они находятся после перезапуска
+	SpillDir string
+}
+
+// Validate проверяет настройки.
+func (o Options) Validate() error {
+	switch o.Overflow {
+	case "", OverflowDropOldest, OverflowBlock:
+	case OverflowSpill:
+		if o.SpillDir == "" {
+			return ErrNoSpillDir
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrBadOverflow, o.Overflow)
+	}
+	return nil
+}
+
+// AuditPublisher рассылает события аудита приемникам.
+// У каждого приемника своя очередь и горутина, поэтому медленный или недоступный приемник
+// не задерживает запросы и не мешает остальным. Нулевое значение готово к работе с настройками по умолчанию.
 type AuditPublisher struct {
-	observers []AuditObserver
+	opts Options
+	log  *zap.Logger
+
+	// mu защищает workers и closed
+	mu      sync.RWMutex
+	workers []*worker
+	closed  bool
+	// publishing - вызовы Publish, которые кладут события в очереди без mu.
+	// Close закрывает очереди только после них, иначе запись в закрытый канал
+	publishing sync.WaitGroup
 }
 
-func (p *AuditPublisher) Register(o AuditObserver) {
-	p.observers = append(p.observers, o)
+// NewPublisher создает рассыльщика с настройками opts.
+func NewPublisher(opts Options, log *zap.Logger) (*AuditPublisher, error) {
+	op := "audit.NewPublisher"
+
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &AuditPublisher{opts: opts, log: log}, nil
 }
 
-func (p *AuditPublisher) Publish(event model.AuditEvent) error {
-	for _, obs := range p.observers {
-		err := obs.Notify(event)
+// Register добавляет приемник и запускает его горутину.
+// Приемники различаются по observerKey: по нему же называется файл OverflowSpill, поэтому повторный ключ отклоняется.
+func (p *AuditPublisher) Register(o AuditObserver) error {
+	op := "audit.Register"
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return fmt.Errorf("%s: %w", op, ErrClosed)
+	}
+	name, key := observerName(o), observerKey(o)
+	for _, w := range p.workers {
+		if w.key == key {
+			return fmt.Errorf("%s: %w: %s", op, ErrDuplicate, name)
+		}
+	}
+
+	size := p.opts.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	overflow := p.opts.Overflow
+	if overflow == "" {
+		overflow = DefaultOverflow
+	}
+	log := p.log
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	w := &worker{
+		observer: o,
+		name:     name,
+		key:      key,
+		queue:    make(chan model.AuditEvent, size),
+		overflow: overflow,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		log:      log,
+	}
+	if overflow == OverflowSpill {
+		s, err := newSpill(p.opts.SpillDir, w.key)
 		if err != nil {
-			return err
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		w.spill = s
+	}
+
+	p.workers = append(p.workers, w)
+	go w.run()
+	return nil
+}
+
+// Publish ставит событие в очередь каждого приемника. Ошибки доставки не возвращаются,
+// а учитываются в Stats: ошибка означает, что событие не удалось принять, например после Close.
+// При OverflowBlock ожидание места в очереди не задерживает Register и Close.
+func (p *AuditPublisher) Publish(event model.AuditEvent) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrClosed
+	}
+	workers := p.workers
+	p.publishing.Add(1)
+	p.mu.RUnlock()
+	defer p.publishing.Done()
+
+	var errs []error
+	for _, w := range workers {
+		if err := w.enqueue(event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats возвращает счетчики приемников в порядке регистрации.
+func (p *AuditPublisher) Stats() []ObserverStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats := make([]ObserverStats, len(p.workers))
+	for i, w := range p.workers {
+		stats[i] = w.stats()
+	}
+	return stats
+}
+
+// Close перестает принимать события и ждет, пока приемники разберут очереди, но не дольше ctx.
+// Файлы OverflowSpill, которые не успели дочитать, остаются до следующего запуска.
+func (p *AuditPublisher) Close(ctx context.Context) error {
+	op := "audit.Close"
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	workers := p.workers
+	p.mu.Unlock()
+
+	// Приемники продолжают разбирать очереди, поэтому заблокированные Publish завершатся
+	published := make(chan struct{})
+	go func() {
+		p.publishing.Wait()
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+
+	for _, w := range workers {
+		close(w.queue)
+	}
+	for _, w := range workers {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, ctx.Err())
 		}
 	}
 	return nil
 }
+
+// observerName возвращает имя приемника для логов и Stats, без учетных данных.
+func observerName(o AuditObserver) string {
+	if s, ok := o.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", o)
+}
+
+// keyer - приемник, у которого имя для отображения не различает разные приемники, например без параметров URL.
+type keyer interface {
+	Key() string
+}
+
+// observerKey возвращает ключ, по которому различаются приемники, по умолчанию совпадает с observerName.
+// Ключ может содержать секреты и используется только через хеш в имени файла OverflowSpill.
+func observerKey(o AuditObserver) string {
+	if k, ok := o.(keyer); ok {
+		return k.Key()
+	}
+	return observerName(o)
+}
@@ -0,0 +1,216 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder запоминает события, пока не откроется gate.
+type recorder struct {
+	name string
+	gate chan struct{}
+	err  error
+
+	mu     sync.Mutex
+	events []model.AuditEvent
+}
+
+func (r *recorder) Notify(event model.AuditEvent) error {
+	if r.gate != nil {
+		<-r.gate
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return r.err
+}
+
+func (r *recorder) String() string {
+	return "recorder:" + r.name
+}
+
+func (r *recorder) timestamps() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ts := make([]int64, len(r.events))
+	for i, e := range r.events {
+		ts[i] = e.TS
+	}
+	return ts
+}
+
+func TestAuditPublisher(t *testing.T) {
+	t.Run("failing observer does not affect others", func(t *testing.T) {
+		p := &AuditPublisher{}
+		failing := &recorder{name: "failing", err: errors.New("sink is down")}
+		ok := &recorder{name: "ok"}
+		require.NoError(t, p.Register(failing))
+		require.NoError(t, p.Register(ok))
+
+		for ts := range int64(3) {
+			require.NoError(t, p.Publish(model.AuditEvent{TS: ts}))
+		}
+		require.NoError(t, p.Close(context.Background()))
+
+		require.Equal(t, []int64{0, 1, 2}, ok.timestamps())
+		stats := p.Stats()
+		require.EqualValues(t, 3, stats[0].Failed)
+		require.EqualValues(t, 3, stats[1].Delivered)
+
+		require.ErrorIs(t, p.Publish(model.AuditEvent{}), ErrClosed)
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		p, err := NewPublisher(Options{QueueSize: 2, Overflow: OverflowDropOldest}, nil)
+		require.NoError(t, err)
+		slow := &recorder{gate: make(chan struct{})}
+		require.NoError(t, p.Register(slow))
+
+		// Первое событие ждет в Notify, очередь вмещает два, остальные вытесняют старые
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 0}))
+		require.Eventually(t, func() bool { return p.Stats()[0].Queued == 0 }, time.Second, time.Millisecond)
+		for ts := int64(1); ts <= 4; ts++ {
+			require.NoError(t, p.Publish(model.AuditEvent{TS: ts}))
+		}
+		close(slow.gate)
+		require.NoError(t, p.Close(context.Background()))
+
+		require.Equal(t, []int64{0, 3, 4}, slow.timestamps())
+		require.EqualValues(t, 2, p.Stats()[0].Dropped)
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		dir := t.TempDir()
+		p, err := NewPublisher(Options{QueueSize: 1, Overflow: OverflowSpill, SpillDir: dir}, nil)
+		require.NoError(t, err)
+		slow := &recorder{gate: make(chan struct{})}
+		require.NoError(t, p.Register(slow))
+
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 0}))
+		require.Eventually(t, func() bool { return p.Stats()[0].Queued == 0 }, time.Second, time.Millisecond)
+		for ts := int64(1); ts <= 3; ts++ {
+			require.NoError(t, p.Publish(model.AuditEvent{TS: ts}))
+		}
+		require.EqualValues(t, 2, p.Stats()[0].Spilled)
+
+		close(slow.gate)
+		require.NoError(t, p.Close(context.Background()))
+
+		require.Equal(t, []int64{0, 1, 2, 3}, slow.timestamps())
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, files)
+	})
+
+	t.Run("spill keeps order", func(t *testing.T) {
+		p, err := NewPublisher(Options{QueueSize: 1, Overflow: OverflowSpill, SpillDir: t.TempDir()}, nil)
+		require.NoError(t, err)
+		slow := &recorder{gate: make(chan struct{})}
+		require.NoError(t, p.Register(slow))
+
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 0}))
+		require.Eventually(t, func() bool { return p.Stats()[0].Queued == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 1}))
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 2}))
+
+		// Очередь освободилась, но событие 3 записывается в файл за событием 2
+		slow.gate <- struct{}{}
+		require.Eventually(t, func() bool { return p.Stats()[0].Queued == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 3}))
+		require.EqualValues(t, 2, p.Stats()[0].Spilled)
+
+		close(slow.gate)
+		require.NoError(t, p.Close(context.Background()))
+		require.Equal(t, []int64{0, 1, 2, 3}, slow.timestamps())
+	})
+
+	t.Run("spill survives restart", func(t *testing.T) {
+		dir := t.TempDir()
+		sink := &recorder{}
+		s, err := newSpill(dir, observerName(sink))
+		require.NoError(t, err)
+		require.NoError(t, s.write(model.AuditEvent{TS: 7}))
+
+		p, err := NewPublisher(Options{Overflow: OverflowSpill, SpillDir: dir}, nil)
+		require.NoError(t, err)
+		require.NoError(t, p.Register(sink))
+		require.NoError(t, p.Close(context.Background()))
+
+		require.Equal(t, []int64{7}, sink.timestamps())
+		_, err = os.Stat(filepath.Join(dir, filepath.Base(s.path)))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("block waits outside the lock", func(t *testing.T) {
+		p, err := NewPublisher(Options{QueueSize: 1, Overflow: OverflowBlock}, nil)
+		require.NoError(t, err)
+		fast := &recorder{name: "fast"}
+		slow := &recorder{name: "slow", gate: make(chan struct{})}
+		require.NoError(t, p.Register(fast))
+		require.NoError(t, p.Register(slow))
+
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 0}))
+		require.Eventually(t, func() bool { return p.Stats()[1].Queued == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, p.Publish(model.AuditEvent{TS: 1}))
+
+		blocked := make(chan error)
+		go func() { blocked <- p.Publish(model.AuditEvent{TS: 2}) }()
+		// fast получил событие 2, значит Publish уже ждет места в очереди slow
+		require.Eventually(t, func() bool { return len(fast.timestamps()) == 3 }, time.Second, time.Millisecond)
+
+		// Пока Publish ждет места, регистрация и Close не блокируются на mu
+		require.NoError(t, p.Register(&recorder{name: "other"}))
+		closed := make(chan error)
+		go func() { closed <- p.Close(context.Background()) }()
+		require.Eventually(t, func() bool {
+			return errors.Is(p.Publish(model.AuditEvent{}), ErrClosed)
+		}, time.Second, time.Millisecond)
+
+		close(slow.gate)
+		require.NoError(t, <-blocked)
+		require.NoError(t, <-closed)
+		require.Equal(t, []int64{0, 1, 2}, slow.timestamps())
+	})
+
+	t.Run("duplicate observer", func(t *testing.T) {
+		p := &AuditPublisher{}
+		require.NoError(t, p.Register(&recorder{name: "a"}))
+		require.ErrorIs(t, p.Register(&recorder{name: "a"}), ErrDuplicate)
+
+		// Адреса, различающиеся только параметрами, - разные приемники, хотя имя у них одно
+		a := NewHTTPAuditObserver("http://audit.local/events?tenant=a")
+		b := NewHTTPAuditObserver("http://audit.local/events?tenant=b")
+		require.Equal(t, observerName(a), observerName(b))
+		require.NoError(t, p.Register(a))
+		require.NoError(t, p.Register(b))
+		require.ErrorIs(t, p.Register(NewHTTPAuditObserver("http://audit.local/events?tenant=a")), ErrDuplicate)
+		require.NoError(t, p.Close(context.Background()))
+	})
+
+	t.Run("close waits no longer than ctx", func(t *testing.T) {
+		p := &AuditPublisher{}
+		stuck := &recorder{gate: make(chan struct{})}
+		require.NoError(t, p.Register(stuck))
+		require.NoError(t, p.Publish(model.AuditEvent{}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.ErrorIs(t, p.Close(ctx), context.Canceled)
+		close(stuck.gate)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		_, err := NewPublisher(Options{Overflow: "retry"}, nil)
+		require.ErrorIs(t, err, ErrBadOverflow)
+		_, err = NewPublisher(Options{Overflow: OverflowSpill}, nil)
+		require.ErrorIs(t, err, ErrNoSpillDir)
+	})
+}
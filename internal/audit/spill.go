@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/model"
+)
+
+// spill - файл событий, не поместившихся в очередь приемника, по событию JSON в строке.
+// Перед чтением файл переименовывается, чтобы новые события писались в новый файл.
+// Если сервер остановится во время чтения, файл дочитается с начала после перезапуска,
+// поэтому часть событий может быть доставлена повторно.
+type spill struct {
+	mu   sync.Mutex
+	path string
+	// pending - в path есть непрочитанные события
+	pending bool
+	// leftover - файл чтения остался от прошлого запуска
+	leftover bool
+}
+
+// newSpill открывает файл приемника name в каталоге dir, имя файла не зависит от порядка регистрации.
+func newSpill(dir, name string) (*spill, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	s := &spill{path: filepath.Join(dir, "audit-"+hex.EncodeToString(sum[:8])+".jsonl")}
+
+	if _, err := os.Stat(s.path); err == nil {
+		s.pending = true
+	}
+	if _, err := os.Stat(s.replayPath()); err == nil {
+		s.leftover = true
+	}
+	return s, nil
+}
+
+func (s *spill) replayPath() string {
+	return s.path + ".replay"
+}
+
+func (s *spill) write(event model.AuditEvent) error {
+	_, err := s.writeIf(event, true)
+	return err
+}
+
+// writeIfPending записывает событие, только если в файле уже есть непрочитанные события:
+// пока они не дочитаны, новые события пишутся за ними, чтобы не обогнать их через очередь.
+func (s *spill) writeIfPending(event model.AuditEvent) (bool, error) {
+	return s.writeIf(event, false)
+}
+
+func (s *spill) writeIf(event model.AuditEvent, always bool) (bool, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !always && !s.pending {
+		return false, nil
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return false, fmt.Errorf("failed to open spill file %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return false, fmt.Errorf("failed to write spill file %s: %w", s.path, err)
+	}
+	s.pending = true
+	return true, nil
+}
+
+// replay передает deliver события одного файла: оставшегося от прошлого запуска или записанного сейчас.
+// Возвращает false, если читать нечего.
+func (s *spill) replay(deliver func(model.AuditEvent)) (bool, error) {
+	s.mu.Lock()
+	if !s.leftover {
+		if !s.pending {
+			s.mu.Unlock()
+			return false, nil
+		}
+		if err := os.Rename(s.path, s.replayPath()); err != nil {
+			s.mu.Unlock()
+			return true, err
+		}
+		s.pending = false
+	}
+	s.leftover = false
+	s.mu.Unlock()
+
+	return true, s.read(deliver)
+}
+
+// read доставляет события файла чтения и удаляет его. Строки, которые не удалось разобрать, пропускаются.
+func (s *spill) read(deliver func(model.AuditEvent)) error {
+	file, err := os.Open(s.replayPath())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var badLines int
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var event model.AuditEvent
+			if jsonErr := json.Unmarshal(line, &event); jsonErr != nil {
+				badLines++
+			} else {
+				deliver(event)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(s.replayPath()); err != nil {
+		return err
+	}
+	if badLines > 0 {
+		return fmt.Errorf("skipped %d malformed lines of %s", badLines, s.replayPath())
+	}
+	return nil
+}
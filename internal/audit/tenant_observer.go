@@ -0,0 +1,29 @@
+package audit
+
+import "github.com/s0n1cAK/yandex-metrics/internal/model"
+
+// TenantAuditObserver передает приемнику только события одного арендатора.
+type TenantAuditObserver struct {
+	tenant string
+	next   AuditObserver
+}
+
+// NewTenantAuditObserver создает приемник событий арендатора tenant.
+func NewTenantAuditObserver(tenant string, next AuditObserver) *TenantAuditObserver {
+	return &TenantAuditObserver{tenant: tenant, next: next}
+}
+
+func (t *TenantAuditObserver) Notify(event model.AuditEvent) error {
+	if event.Tenant != t.tenant {
+		return nil
+	}
+	return t.next.Notify(event)
+}
+
+func (t *TenantAuditObserver) String() string {
+	return "tenant:" + t.tenant + ":" + observerName(t.next)
+}
+
+func (t *TenantAuditObserver) Key() string {
+	return "tenant:" + t.tenant + ":" + observerKey(t.next)
+}
@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"sync/atomic"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// ObserverStats - счетчики событий одного приемника.
+type ObserverStats struct {
+	Name string `json:"name"`
+	// Queued - событий в очереди сейчас
+	Queued int `json:"queued"`
+	// Delivered и Failed - событий, доставленных приемнику и завершившихся ошибкой
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	// Dropped - событий, вытесненных из заполненной очереди или не записанных в файл
+	Dropped int64 `json:"dropped"`
+	// Spilled - событий, записанных в файл при заполненной очереди
+	Spilled int64 `json:"spilled"`
+}
+
+// worker доставляет события одному приемнику.
+type worker struct {
+	observer AuditObserver
+	name     string
+	// key различает приемники, см. observerKey
+	key      string
+	queue    chan model.AuditEvent
+	overflow OverflowPolicy
+	// spill задан только при OverflowSpill
+	spill *spill
+	// wake будит горутину, когда событие записано в файл, а не в очередь
+	wake chan struct{}
+	done chan struct{}
+	log  *zap.Logger
+
+	delivered atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+	spilled   atomic.Int64
+}
+
+// enqueue кладет событие в очередь по правилу overflow.
+func (w *worker) enqueue(event model.AuditEvent) error {
+	switch w.overflow {
+	case OverflowBlock:
+		w.queue <- event
+		return nil
+	case OverflowSpill:
+		// Пока файл не дочитан, события пишутся в него, чтобы доставка шла в порядке публикации
+		spilled, err := w.spill.writeIfPending(event)
+		if err == nil && !spilled {
+			select {
+			case w.queue <- event:
+				return nil
+			default:
+			}
+			err = w.spill.write(event)
+		}
+		if err != nil {
+			w.dropped.Add(1)
+			return err
+		}
+		w.spilled.Add(1)
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case w.queue <- event:
+			return nil
+		default:
+		}
+		// Очередь могла опустеть между попытками, тогда вытеснять нечего
+		select {
+		case <-w.queue:
+			w.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (w *worker) run() {
+	defer close(w.done)
+
+	// События, записанные в файл до перезапуска
+	w.replay()
+
+	for {
+		select {
+		case event, ok := <-w.queue:
+			if !ok {
+				w.replay()
+				return
+			}
+			w.deliver(event)
+		case <-w.wake:
+		}
+		w.replay()
+	}
+}
+
+func (w *worker) deliver(event model.AuditEvent) {
+	if err := w.observer.Notify(event); err != nil {
+		w.failed.Add(1)
+		w.log.Error("Failed to deliver audit event", zap.String("observer", w.name), zap.Error(err))
+		return
+	}
+	w.delivered.Add(1)
+}
+
+// replay доставляет события из файла OverflowSpill, когда очередь пуста:
+// события в очереди старше тех, что записаны в файл после начала его чтения.
+func (w *worker) replay() {
+	if w.spill == nil {
+		return
+	}
+	for len(w.queue) == 0 {
+		ok, err := w.spill.replay(w.deliver)
+		if err != nil {
+			w.log.Error("Failed to replay spilled audit events", zap.String("observer", w.name), zap.Error(err))
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+func (w *worker) stats() ObserverStats {
+	return ObserverStats{
+		Name:      w.name,
+		Queued:    len(w.queue),
+		Delivered: w.delivered.Load(),
+		Failed:    w.failed.Load(),
+		Dropped:   w.dropped.Load(),
+		Spilled:   w.spilled.Load(),
+	}
+}
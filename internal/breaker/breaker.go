@@ -0,0 +1,141 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State - состояние автомата
+type State int32
+
+const (
+	// Closed - запросы проходят, ошибки подсчитываются
+	Closed State = iota
+	// HalfOpen - после паузы пропускается ограниченное число пробных запросов
+	HalfOpen
+	// Open - запросы отклоняются без обращения к сети
+	Open
+)
+
+// ErrOpen возвращается, когда автомат не пропускает запрос.
+var ErrOpen = errors.New("circuit breaker is open")
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Breaker - автоматический выключатель: после threshold ошибок подряд переходит в Open
+// и отклоняет запросы в течение coolDown, затем пропускает до halfOpenMax пробных запросов.
+// Успешный пробный запрос закрывает автомат, ошибка снова открывает его.
+type Breaker struct {
+	mu          sync.Mutex
+	state       State
+	failures    int
+	inFlight    int
+	openedAt    time.Time
+	opens       int64
+	threshold   int
+	coolDown    time.Duration
+	halfOpenMax int
+	now         func() time.Time
+}
+
+func New(threshold int, coolDown time.Duration, halfOpenMax int) *Breaker {
+	if halfOpenMax <= 0 {
+		halfOpenMax = 1
+	}
+	return &Breaker{
+		threshold:   threshold,
+		coolDown:    coolDown,
+		halfOpenMax: halfOpenMax,
+		now:         time.Now,
+	}
+}
+
+// Allow проверяет, можно ли выполнить запрос.
+// Каждый разрешенный запрос должен завершиться вызовом Success или Failure.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.coolDown {
+		b.state = HalfOpen
+		b.inFlight = 0
+	}
+
+	switch b.state {
+	case Open:
+		return ErrOpen
+	case HalfOpen:
+		if b.inFlight >= b.halfOpenMax {
+			return ErrOpen
+		}
+		b.inFlight++
+	}
+	return nil
+}
+
+// Success фиксирует успешный запрос.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.inFlight = 0
+	b.state = Closed
+}
+
+// Failure фиксирует неуспешный запрос.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		if b.state != Open {
+			b.opens++
+		}
+		b.state = Open
+		b.openedAt = b.now()
+		b.inFlight = 0
+	}
+}
+
+// Release возвращает разрешение, если запрос так и не был выполнен.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen && b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+// State возвращает текущее состояние с учетом истекшей паузы.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.coolDown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Opens возвращает, сколько раз автомат переходил в Open.
+func (b *Breaker) Opens() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.opens
+}
@@ -0,0 +1,52 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := New(2, time.Minute, 1)
+	b.now = func() time.Time { return now }
+
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.Equal(t, Closed, b.State())
+
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.Equal(t, Open, b.State())
+	require.ErrorIs(t, b.Allow(), ErrOpen)
+
+	// После паузы пропускается только один пробный запрос
+	now = now.Add(time.Minute)
+	require.Equal(t, HalfOpen, b.State())
+	require.NoError(t, b.Allow())
+	require.ErrorIs(t, b.Allow(), ErrOpen)
+
+	b.Failure()
+	require.Equal(t, Open, b.State())
+	require.Equal(t, int64(2), b.Opens())
+
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	b.Success()
+	require.Equal(t, Closed, b.State())
+	require.NoError(t, b.Allow())
+}
+
+func TestBreaker_Release(t *testing.T) {
+	now := time.Now()
+	b := New(1, time.Minute, 1)
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	now = now.Add(time.Minute)
+
+	require.NoError(t, b.Allow())
+	b.Release()
+	require.NoError(t, b.Allow())
+}
@@ -0,0 +1,205 @@
+// Package certs настраивает TLS сервера и агента.
+//
+// Сертификат сервера перечитывается при изменении файлов без перезапуска,
+// агент может проверять сервер по своему CA и по отпечатку сертификата.
+package certs
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoCertificates = errors.New("no certificates in CA file")
+	ErrPinMismatch    = errors.New("server certificate fingerprint does not match pin")
+	ErrBadPin         = errors.New("pin must be hex SHA-256 of certificate")
+)
+
+// Reloader хранит пару сертификат-ключ и перечитывает ее при изменении файлов.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	log      *zap.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader читает сертификат и ключ.
+func NewReloader(certFile, keyFile string, log *zap.Logger) (*Reloader, error) {
+	op := "certs.NewReloader"
+
+	r := &Reloader{certFile: certFile, keyFile: keyFile, log: log}
+	if _, err := r.reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// GetCertificate возвращает текущий сертификат для tls.Config.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch проверяет время изменения файлов до отмены ctx.
+// При ошибке чтения продолжает действовать прежний сертификат.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			updated, err := r.reload()
+			if err != nil {
+				r.log.Error("Failed to reload certificate", zap.String("cert", r.certFile), zap.Error(err))
+				continue
+			}
+			if updated {
+				r.log.Info("Certificate reloaded", zap.String("cert", r.certFile))
+			}
+		}
+	}
+}
+
+// reload перечитывает пару, если изменился хотя бы один из файлов.
+func (r *Reloader) reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	same := modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ServerConfig возвращает настройки TLS сервера.
+// Если clientCA не пуст, сервер требует сертификат клиента, подписанный этим CA.
+func ServerConfig(r *Reloader, clientCA string) (*tls.Config, error) {
+	op := "certs.ServerConfig"
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+
+	if clientCA != "" {
+		pool, err := loadPool(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// ClientConfig возвращает настройки TLS агента.
+// ca - CA для проверки сервера, пустой оставляет системные. certFile и keyFile - сертификат клиента для mTLS.
+// pin - SHA-256 сертификата сервера в hex (двоеточия допускаются); сервер с другим сертификатом отклоняется.
+// Закрепленный сертификат без ca может быть самоподписанным: отпечаток заменяет проверку цепочки.
+func ClientConfig(ca, certFile, keyFile, pin string) (*tls.Config, error) {
+	op := "certs.ClientConfig"
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if ca != "" {
+		pool, err := loadPool(ca)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if pin != "" {
+		want, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+		if err != nil || len(want) != sha256.Size {
+			return nil, fmt.Errorf("%s: %w", op, ErrBadPin)
+		}
+		cfg.InsecureSkipVerify = ca == ""
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return ErrPinMismatch
+			}
+			if Fingerprint(cs.PeerCertificates[0]) != hex.EncodeToString(want) {
+				return ErrPinMismatch
+			}
+			return nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// Fingerprint возвращает SHA-256 сертификата в hex.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCertificates, path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,164 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// issue выпускает сертификат с именем name, подписанный parent, или самоподписанный CA при parent == nil.
+func issue(t *testing.T, dir, name string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signerCert, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	tc := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(tc.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	require.NoError(t, os.WriteFile(tc.keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return tc
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, dir, "ca", nil)
+	serverCert := issue(t, dir, "server", ca)
+	agentCert := issue(t, dir, "agent-1", ca)
+
+	reloader, err := NewReloader(serverCert.certFile, serverCert.keyFile, zap.NewNop())
+	require.NoError(t, err)
+	serverTLS, err := ServerConfig(reloader, ca.certFile)
+	require.NoError(t, err)
+
+	var peer string
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer = r.TLS.PeerCertificates[0].Subject.CommonName
+		}),
+		TLSConfig: serverTLS,
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	// Как и сервер метрик, сертификат берется только из GetCertificate
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+
+	get := func(cfg *tls.Config) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := client.Get("https://" + ln.Addr().String())
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// Сертификат агента подписан CA сервера
+	clientTLS, err := ClientConfig(ca.certFile, agentCert.certFile, agentCert.keyFile, "")
+	require.NoError(t, err)
+	require.NoError(t, get(clientTLS))
+	require.Equal(t, "agent-1", peer)
+
+	// Без сертификата клиента сервер отклоняет соединение
+	noCert, err := ClientConfig(ca.certFile, "", "", "")
+	require.NoError(t, err)
+	require.Error(t, get(noCert))
+
+	// Закрепленный отпечаток
+	pinned, err := ClientConfig(ca.certFile, agentCert.certFile, agentCert.keyFile, Fingerprint(serverCert.cert))
+	require.NoError(t, err)
+	require.NoError(t, get(pinned))
+
+	wrongPin, err := ClientConfig(ca.certFile, agentCert.certFile, agentCert.keyFile, Fingerprint(agentCert.cert))
+	require.NoError(t, err)
+	require.ErrorIs(t, get(wrongPin), ErrPinMismatch)
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, dir, "ca", nil)
+	first := issue(t, dir, "server", ca)
+
+	reloader, err := NewReloader(first.certFile, first.keyFile, zap.NewNop())
+	require.NoError(t, err)
+
+	updated, err := reloader.reload()
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	// Новый сертификат записывается поверх прежних файлов
+	second := issue(t, dir, "server", ca)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(second.certFile, later, later))
+
+	updated, err = reloader.reload()
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, second.cert.Raw, cert.Certificate[0])
+}
+
+func TestClientConfig_BadPin(t *testing.T) {
+	_, err := ClientConfig("", "", "", "abc")
+	require.ErrorIs(t, err, ErrBadPin)
+}
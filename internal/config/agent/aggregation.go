@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Режимы агрегации gauge между отчетами
+const (
+	AggregationLast = "last"
+	AggregationMin  = "min"
+	AggregationMax  = "max"
+	AggregationAvg  = "avg"
+	AggregationAll  = "all"
+)
+
+// Aggregation задает режим агрегации gauge по умолчанию и переопределения для отдельных метрик.
+// Формат: "avg,HeapAlloc=max,RandomValue=all" - элемент без имени задает режим по умолчанию.
+type Aggregation struct {
+	Default   string
+	PerMetric map[string]string
+}
+
+func isAggregationMode(mode string) bool {
+	switch mode {
+	case AggregationLast, AggregationMin, AggregationMax, AggregationAvg, AggregationAll:
+		return true
+	}
+	return false
+}
+
+func formatAggregation(value string) (Aggregation, error) {
+	a := Aggregation{Default: AggregationLast, PerMetric: make(map[string]string)}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, mode, ok := strings.Cut(item, "=")
+		if !ok {
+			mode, name = name, ""
+		}
+		mode = strings.ToLower(strings.TrimSpace(mode))
+
+		if !isAggregationMode(mode) {
+			return Aggregation{}, fmt.Errorf("unknown aggregation mode %q", mode)
+		}
+
+		if name == "" {
+			a.Default = mode
+		} else {
+			a.PerMetric[strings.TrimSpace(name)] = mode
+		}
+	}
+
+	return a, nil
+}
+
+// Mode возвращает режим агрегации для метрики.
+func (a *Aggregation) Mode(name string) string {
+	if mode, ok := a.PerMetric[name]; ok {
+		return mode
+	}
+	if a.Default == "" {
+		return AggregationLast
+	}
+	return a.Default
+}
+
+func (a *Aggregation) String() string {
+	if a == nil {
+		return ""
+	}
+
+	items := make([]string, 0, len(a.PerMetric)+1)
+	items = append(items, a.Default)
+	for name, mode := range a.PerMetric {
+		items = append(items, name+"="+mode)
+	}
+	sort.Strings(items[1:])
+	return strings.Join(items, ",")
+}
+
+func (a *Aggregation) Set(value string) error {
+	gValue, err := formatAggregation(value)
+	if err != nil {
+		return err
+	}
+	*a = gValue
+	return nil
+}
+
+func (a *Aggregation) UnmarshalText(text []byte) error {
+	return a.Set(string(text))
+}
@@ -3,39 +3,99 @@ package agent
 import (
 	"flag"
 	"os"
+	"strings"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/hashicorp/go-retryablehttp"
 	"go.uber.org/zap"
 )
 
-func LoadConfig(fs *flag.FlagSet, args []string, log *zap.Logger) (Config, error) {
+// Default возвращает конфигурацию со значениями по умолчанию и настроенными повторами запросов.
+func Default(log *zap.Logger) Config {
 	cfg := Config{
-		Client:         &retryablehttp.Client{},
-		Endpoint:       DefaultEndpoint,
-		ReportInterval: DefaultReportInterval,
-		PollInterval:   DefaultPollInterval,
-		Logger:         log,
-		Hash:           DefaultHashKey,
-		RateLimit:      DefaultRateLimit,
+		Client:             &retryablehttp.Client{},
+		Mode:               DefaultMode,
+		PullAddress:        DefaultPullAddress,
+		Endpoints:          DefaultEndpoints,
+		Strategy:           DefaultStrategy,
+		FailoverErrors:     DefaultFailoverErrors,
+		ProbeInterval:      DefaultProbeInterval,
+		BreakerErrors:      DefaultBreakerErrors,
+		BreakerCoolDown:    DefaultBreakerCoolDown,
+		BreakerHalfOpen:    DefaultBreakerHalfOpen,
+		ReportInterval:     DefaultReportInterval,
+		PollInterval:       DefaultPollInterval,
+		Logger:             log,
+		Hash:               DefaultHashKey,
+		RateLimit:          DefaultRateLimit,
+		BatchSize:          DefaultBatchSize,
+		BatchBytes:         DefaultBatchBytes,
+		StatsDAddress:      DefaultStatsDAddress,
+		SelfMetricsAddress: DefaultSelfMetricsAddress,
+		OutboxDir:          DefaultOutboxDir,
+		OutboxMaxSize:      DefaultOutboxMaxSize,
+		OutboxMaxAge:       DefaultOutboxMaxAge,
+		ShutdownTimeout:    DefaultShutdownTimeout,
+		Aggregation:        DefaultAggregation,
+		AgentIDFile:        DefaultAgentIDFile,
 	}
 
+	configureRetries(cfg)
+
+	return cfg
+}
+
+func LoadConfig(fs *flag.FlagSet, args []string, log *zap.Logger) (Config, error) {
+	cfg := Default(log)
+
 	if err := env.Parse(&cfg); err != nil {
 		return Config{}, err
 	}
 
-	fs.Var(&cfg.Endpoint, "a", "Server address, e.g. http://host:port")
+	fs.StringVar(&cfg.Mode, "mode", cfg.Mode, "Agent mode: push sends metrics to server, pull serves them for scraping")
+	fs.StringVar(&cfg.PullAddress, "pull-address", cfg.PullAddress, "Listen address for /metrics in pull mode")
+	fs.Var(&cfg.Endpoints, "a", "Server address, e.g. http://host:port, or comma-separated list")
+	fs.Func("endpoint-keys", "Comma-separated hash keys per server address, empty item uses -k", func(value string) error {
+		cfg.EndpointKeys = strings.Split(value, ",")
+		return nil
+	})
+	fs.StringVar(&cfg.Strategy, "strategy", cfg.Strategy, "Strategy for multiple addresses: failover|fanout")
+	fs.IntVar(&cfg.FailoverErrors, "failover-threshold", cfg.FailoverErrors, "Consecutive errors before switching to the next address")
+	fs.Var(&cfg.ProbeInterval, "probe-interval", "Interval of primary address health probes in failover mode (e.g. 30s)")
 	fs.Var(&cfg.ReportInterval, "r", "Report interval (e.g. 10s)")
 	fs.Var(&cfg.PollInterval, "p", "Poll interval (e.g. 2s)")
-	fs.StringVar(&cfg.Hash, "k", cfg.Hash, "Key to make hash")
+	fs.StringVar(&cfg.Hash, "k", cfg.Hash, "Key to make legacy HashSHA256 header")
+	fs.StringVar(&cfg.SignKeyID, "sign-key-id", cfg.SignKeyID, "ID of HMAC signing key known to the server")
+	fs.StringVar(&cfg.Token, "token", cfg.Token, "Bearer token with write scope issued by \"server tokens create\"")
+	fs.StringVar(&cfg.Tenant, "tenant", cfg.Tenant, "Tenant on the server, empty for the default tenant")
+	fs.StringVar(&cfg.TLSCA, "tls-ca", cfg.TLSCA, "Path to CA (PEM) to verify server certificate, empty for system roots")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "Path to agent client certificate (PEM) for mutual TLS")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "Path to agent client private key (PEM)")
+	fs.StringVar(&cfg.TLSPin, "tls-pin", cfg.TLSPin, "Hex SHA-256 fingerprint of the only accepted server certificate")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "Path to server public key (PEM, RSA or EC) to encrypt reports")
+	fs.StringVar(&cfg.SignKey, "sign-key", cfg.SignKey, "HMAC signing key, empty to disable request signing")
 	fs.IntVar(&cfg.RateLimit, "l", cfg.RateLimit, "Request rate limit to server")
+	fs.IntVar(&cfg.BreakerErrors, "breaker-threshold", cfg.BreakerErrors, "Consecutive failed requests that open the circuit breaker")
+	fs.Var(&cfg.BreakerCoolDown, "breaker-cooldown", "Time the circuit breaker stays open (e.g. 30s)")
+	fs.IntVar(&cfg.BreakerHalfOpen, "breaker-half-open", cfg.BreakerHalfOpen, "Trial requests allowed in half-open state")
+	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "Max metrics per report request, 0 for no limit")
+	fs.IntVar(&cfg.BatchBytes, "batch-bytes", cfg.BatchBytes, "Max JSON size of report request in bytes, 0 for no limit")
+	fs.StringVar(&cfg.OutboxDir, "outbox-dir", cfg.OutboxDir, "Directory for unsent batches, empty to disable")
+	fs.Int64Var(&cfg.OutboxMaxSize, "outbox-max-size", cfg.OutboxMaxSize, "Outbox size limit in bytes")
+	fs.Var(&cfg.OutboxMaxAge, "outbox-max-age", "Max age of unsent batch (e.g. 24h)")
+	fs.Var(&cfg.ShutdownTimeout, "shutdown-timeout", "Time limit for the final report on shutdown (e.g. 10s)")
+	fs.Var(&cfg.Aggregation, "gauge-aggregation", "Gauge aggregation between reports: last|min|max|avg|all, with per-metric overrides, e.g. avg,HeapAlloc=max")
+	fs.StringVar(&cfg.AgentIDFile, "agent-id-file", cfg.AgentIDFile, "File with persistent agent instance ID, default is in the user cache directory, empty for a new ID on each start")
+	fs.StringVar(&cfg.Group, "group", cfg.Group, "Agent group used by the server to select remote settings")
+	fs.BoolVar(&cfg.RemoteConfig, "remote-config", cfg.RemoteConfig, "Receive poll/report intervals, rate limit and collectors from the server")
+	fs.StringVar(&cfg.RelabelConfig, "relabel-config", cfg.RelabelConfig, "Path to JSON file with relabeling rules applied before report")
+	fs.StringVar(&cfg.SelfMetricsAddress, "self-metrics-address", cfg.SelfMetricsAddress, "Local address for agent self metrics endpoint, e.g. localhost:9102")
+	fs.StringVar(&cfg.StatsDAddress, "statsd", cfg.StatsDAddress, "StatsD listen address, e.g. udp://:8125 or unixgram:///tmp/statsd.sock")
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
 	}
 
-	configureRetries(cfg)
-
 	if err := ValidateConfig(cfg); err != nil {
 		return Config{}, err
 	}
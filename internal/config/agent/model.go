@@ -1,6 +1,8 @@
 package agent
 
 import (
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
@@ -8,20 +10,108 @@ import (
 	"go.uber.org/zap"
 )
 
+// Стратегии отправки при нескольких адресах сервера
+const (
+	// StrategyFailover - отправка на первый доступный адрес с переключением после серии ошибок
+	StrategyFailover = "failover"
+	// StrategyFanout - отправка каждого пакета на все адреса
+	StrategyFanout = "fanout"
+)
+
+// Режимы работы агента
+const (
+	// ModePush - агент сам отправляет метрики на сервер
+	ModePush = "push"
+	// ModePull - агент отдает метрики на локальном адресе, сервер забирает их сам
+	ModePull = "pull"
+)
+
 type Config struct {
-	Client         *retryablehttp.Client
-	Endpoint       customtype.Endpoint `env:"ADDRESS"`
-	ReportInterval customtype.Time     `env:"REPORT_INTERVAL"`
-	PollInterval   customtype.Time     `env:"POLL_INTERVAL"`
-	Hash           string              `env:"KEY"`
-	RateLimit      int                 `env:"RATE_LIMIT"`
-	Logger         *zap.Logger
+	Client *retryablehttp.Client
+	Mode   string `env:"MODE"`
+	// PullAddress - адрес, на котором агент отдает метрики в режиме pull
+	PullAddress     string               `env:"PULL_ADDRESS"`
+	Endpoints       customtype.Endpoints `env:"ADDRESS"`
+	EndpointKeys    []string             `env:"ENDPOINT_KEYS"`
+	Strategy        string               `env:"REPORT_STRATEGY"`
+	FailoverErrors  int                  `env:"FAILOVER_THRESHOLD"`
+	ProbeInterval   customtype.Time      `env:"PROBE_INTERVAL"`
+	BreakerErrors   int                  `env:"BREAKER_THRESHOLD"`
+	BreakerCoolDown customtype.Time      `env:"BREAKER_COOLDOWN"`
+	BreakerHalfOpen int                  `env:"BREAKER_HALF_OPEN"`
+	ReportInterval  customtype.Time      `env:"REPORT_INTERVAL"`
+	PollInterval    customtype.Time      `env:"POLL_INTERVAL"`
+	Hash            string               `env:"KEY"`
+	// SignKeyID и SignKey - ключ подписи HMAC, пустой SignKey отключает подпись
+	SignKeyID string `env:"SIGN_KEY_ID"`
+	SignKey   string `env:"SIGN_KEY"`
+	// Token - токен доступа к API сервера с областью write
+	Token string `env:"TOKEN"`
+	// Tenant - арендатор на сервере, токен с арендатором задает его сам
+	Tenant string `env:"TENANT"`
+	// TLSCA - CA сервера, TLSCert и TLSKey - сертификат агента для mTLS
+	TLSCA   string `env:"TLS_CA"`
+	TLSCert string `env:"TLS_CERT"`
+	TLSKey  string `env:"TLS_KEY"`
+	// TLSPin - SHA-256 сертификата сервера в hex, с ним агент подключается только к этому сертификату
+	TLSPin string `env:"TLS_PIN"`
+	// CryptoKey - PEM-файл с открытым ключом сервера для шифрования отчетов, пустой отключает шифрование
+	CryptoKey     string `env:"CRYPTO_KEY"`
+	RateLimit     int    `env:"RATE_LIMIT"`
+	BatchSize     int    `env:"REPORT_BATCH_SIZE"`
+	BatchBytes    int    `env:"REPORT_BATCH_BYTES"`
+	StatsDAddress string `env:"STATSD_ADDRESS"`
+	// SelfMetricsAddress - адрес локального /metrics с метриками самого агента
+	SelfMetricsAddress string          `env:"SELF_METRICS_ADDRESS"`
+	OutboxDir          string          `env:"OUTBOX_DIR"`
+	OutboxMaxSize      int64           `env:"OUTBOX_MAX_SIZE"`
+	OutboxMaxAge       customtype.Time `env:"OUTBOX_MAX_AGE"`
+	ShutdownTimeout    customtype.Time `env:"SHUTDOWN_TIMEOUT"`
+	Aggregation        Aggregation     `env:"GAUGE_AGGREGATION"`
+	// RelabelConfig - путь к JSON-файлу с правилами фильтрации и переименования метрик
+	RelabelConfig string `env:"RELABEL_CONFIG"`
+	// AgentIDFile - файл с идентификатором экземпляра агента, пустой путь дает новый ID при каждом запуске
+	AgentIDFile string `env:"AGENT_ID_FILE"`
+	// Group - группа агента для выбора настроек на сервере
+	Group string `env:"AGENT_GROUP"`
+	// RemoteConfig включает получение настроек с сервера через /agent-config
+	RemoteConfig bool `env:"REMOTE_CONFIG"`
+	Logger       *zap.Logger
 }
 
 var (
-	DefaultEndpoint       = customtype.Endpoint("http://localhost:8080")
-	DefaultReportInterval = customtype.Time(10 * time.Second)
-	DefaultPollInterval   = customtype.Time(2 * time.Second)
-	DefaultHashKey        = ""
-	DefaultRateLimit      = 10
+	DefaultEndpoint           = customtype.Endpoint("http://localhost:8080")
+	DefaultEndpoints          = customtype.Endpoints{DefaultEndpoint}
+	DefaultStrategy           = StrategyFailover
+	DefaultMode               = ModePush
+	DefaultPullAddress        = ":9101"
+	DefaultFailoverErrors     = 3
+	DefaultProbeInterval      = customtype.Time(30 * time.Second)
+	DefaultBreakerErrors      = 5
+	DefaultBreakerCoolDown    = customtype.Time(30 * time.Second)
+	DefaultBreakerHalfOpen    = 1
+	DefaultReportInterval     = customtype.Time(10 * time.Second)
+	DefaultPollInterval       = customtype.Time(2 * time.Second)
+	DefaultHashKey            = ""
+	DefaultRateLimit          = 10
+	DefaultBatchSize          = 1000
+	DefaultBatchBytes         = 4 * 1024 * 1024
+	DefaultStatsDAddress      = ""
+	DefaultSelfMetricsAddress = ""
+	DefaultOutboxDir          = ""
+	DefaultOutboxMaxSize      = int64(64 * 1024 * 1024)
+	DefaultOutboxMaxAge       = customtype.Time(24 * time.Hour)
+	DefaultShutdownTimeout    = customtype.Time(10 * time.Second)
+	DefaultAggregation        = Aggregation{Default: AggregationLast}
+	DefaultAgentIDFile        = defaultAgentIDFile()
 )
+
+// defaultAgentIDFile возвращает путь к файлу идентификатора в кэше пользователя, а не в рабочем каталоге.
+// Без каталога кэша, например без HOME, идентификатор не сохраняется.
+func defaultAgentIDFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "yandex-metrics", "agent.id")
+}
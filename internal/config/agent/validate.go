@@ -1,22 +1,81 @@
 package agent
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+)
 
 var (
-	ErrEmptyEndpoint = errors.New("endpoint is empty")
-	ErrBadReport     = errors.New("report interval must be > 0")
-	ErrBadPoll       = errors.New("poll interval must be > 0")
+	ErrEmptyEndpoint   = errors.New("endpoint is empty")
+	ErrBadReport       = errors.New("report interval must be > 0")
+	ErrBadPoll         = errors.New("poll interval must be > 0")
+	ErrBadOutbox       = errors.New("outbox limits must be >= 0")
+	ErrBadShutdown     = errors.New("shutdown timeout must be > 0")
+	ErrBadBatch        = errors.New("batch limits must be >= 0")
+	ErrBadRateLimit    = errors.New("rate limit must be > 0")
+	ErrBadStrategy     = errors.New("strategy must be failover or fanout")
+	ErrBadEndpointKeys = errors.New("more endpoint keys than endpoints")
+	ErrBadFailover     = errors.New("failover threshold must be > 0")
+	ErrBadProbe        = errors.New("probe interval must be > 0")
+	ErrBadBreaker      = errors.New("breaker threshold, cooldown and half-open limit must be > 0")
+	ErrBadMode         = errors.New("mode must be push or pull")
+	ErrEmptyPull       = errors.New("pull address is empty")
+	ErrEmptySignKeyID  = errors.New("sign key id is empty while sign key is set")
+	ErrBadTLS          = errors.New("tls cert and key must be set together")
 )
 
 func ValidateConfig(cfg Config) error {
-	if cfg.Endpoint == "" {
+	if cfg.Mode != ModePush && cfg.Mode != ModePull {
+		return ErrBadMode
+	}
+	if cfg.Mode == ModePull && cfg.PullAddress == "" {
+		return ErrEmptyPull
+	}
+	if len(cfg.Endpoints) == 0 {
 		return ErrEmptyEndpoint
 	}
+	if len(cfg.EndpointKeys) > len(cfg.Endpoints) {
+		return ErrBadEndpointKeys
+	}
+	if cfg.Strategy != StrategyFailover && cfg.Strategy != StrategyFanout {
+		return ErrBadStrategy
+	}
+	if cfg.FailoverErrors <= 0 {
+		return ErrBadFailover
+	}
+	if cfg.ProbeInterval.Duration() <= 0 {
+		return ErrBadProbe
+	}
+	if cfg.BreakerErrors <= 0 || cfg.BreakerCoolDown.Duration() <= 0 || cfg.BreakerHalfOpen <= 0 {
+		return ErrBadBreaker
+	}
 	if cfg.ReportInterval.Duration() <= 0 {
 		return ErrBadReport
 	}
 	if cfg.PollInterval.Duration() <= 0 {
 		return ErrBadPoll
 	}
+	if cfg.RateLimit <= 0 {
+		return ErrBadRateLimit
+	}
+	if cfg.BatchSize < 0 || cfg.BatchBytes < 0 {
+		return ErrBadBatch
+	}
+	if cfg.ShutdownTimeout.Duration() <= 0 {
+		return ErrBadShutdown
+	}
+	if cfg.OutboxMaxSize < 0 || cfg.OutboxMaxAge.Duration() < 0 {
+		return ErrBadOutbox
+	}
+	if cfg.SignKey != "" && cfg.SignKeyID == "" {
+		return ErrEmptySignKeyID
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return ErrBadTLS
+	}
+	if err := tenant.Validate(cfg.Tenant); err != nil {
+		return err
+	}
 	return nil
 }
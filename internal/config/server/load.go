@@ -11,12 +11,19 @@ import (
 
 func LoadConfig(fs *pflag.FlagSet, args []string, logger *zap.Logger) (Config, error) {
 	cfg := Config{
-		Endpoint:      DefaultEndpoint,
-		StoreInterval: DefaultStoreInterval,
-		File:          DefaultFile,
-		Restore:       DefaultRestore,
-		DSN:           customtype.DSN{},
-		Logger:        logger,
+		Endpoint:       DefaultEndpoint,
+		StoreInterval:  DefaultStoreInterval,
+		File:           DefaultFile,
+		Restore:        DefaultRestore,
+		ScrapeInterval: DefaultScrapeInterval,
+		ScrapeTimeout:  DefaultScrapeTimeout,
+		ScrapeJitter:   DefaultScrapeJitter,
+		AgentSilence:   DefaultAgentSilence,
+		SignSkew:       DefaultSignSkew,
+		AuditQueueSize: DefaultAuditQueueSize,
+		AuditOverflow:  DefaultAuditOverflow,
+		DSN:            customtype.DSN{},
+		Logger:         logger,
 	}
 
 	if err := env.Parse(&cfg); err != nil {
@@ -28,10 +35,41 @@ func LoadConfig(fs *pflag.FlagSet, args []string, logger *zap.Logger) (Config, e
 	fs.StringVarP(&cfg.File, "file", "f", cfg.File, "Storage file path")
 	fs.BoolVarP(&cfg.Restore, "restore", "r", cfg.Restore, "Restore metrics from file on start")
 	fs.VarP(&cfg.DSN, "dsn", "d", "Database DSN")
-	fs.StringVarP(&cfg.HashKey, "hash-key", "k", cfg.HashKey, "Hash key to validate request from agent")
+	fs.StringVarP(&cfg.HashKey, "hash-key", "k", cfg.HashKey, "Hash key to validate legacy HashSHA256 header")
+	fs.Var(&cfg.SignKeys, "sign-keys", "Comma-separated HMAC signing keys as id:key, e.g. v1:old,v2:new")
+	fs.Var(&cfg.SignSkew, "sign-skew", "Allowed clock skew of signed requests (e.g. 5m)")
+	fs.StringVar(&cfg.SignKeyID, "sign-key-id", cfg.SignKeyID, "ID of key from --sign-keys used to sign responses")
+	fs.StringSliceVar(&cfg.SignExempt, "sign-exempt", cfg.SignExempt, "Comma-separated paths of write requests accepted without signature")
+	fs.BoolVar(&cfg.LegacyHash, "legacy-hash", cfg.LegacyHash, "Accept HashSHA256 header by --hash-key when --sign-keys is set")
+
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "Path to server TLS certificate (PEM), reloaded on change")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "Path to server TLS private key (PEM)")
+	fs.StringVar(&cfg.TLSClientCA, "tls-client-ca", cfg.TLSClientCA, "Path to CA (PEM) of client certificates, enables mutual TLS")
+	fs.StringSliceVarP(&cfg.TrustedSubnet, "trusted-subnet", "t", cfg.TrustedSubnet, "Comma-separated CIDR allowed to write metrics, checked against X-Real-IP")
+	fs.StringVar(&cfg.TenantsFile, "tenants-file", cfg.TenantsFile, "JSON file with per-tenant hash key, audit sinks and quotas")
+	fs.StringVar(&cfg.TokenStore, "token-store", cfg.TokenStore, "Bearer token store: path to JSON file or \"postgres\" for --dsn, empty to disable authentication")
+	fs.Float64Var(&cfg.ClientRateLimit, "client-rate-limit", cfg.ClientRateLimit, "Write requests per second allowed to each client, 0 to disable")
+	fs.IntVar(&cfg.ClientRateBurst, "client-rate-burst", cfg.ClientRateBurst, "Write requests a client may send at once above --client-rate-limit")
+	fs.IntVar(&cfg.MaxMetrics, "max-metrics", cfg.MaxMetrics, "Max metrics of a tenant without its own quota, 0 for no limit")
+	fs.IntVar(&cfg.MaxClientMetrics, "max-client-metrics", cfg.MaxClientMetrics, "Max distinct metrics written by one client, 0 for no limit")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "Path to private key (PEM, RSA or EC) to decrypt agent reports")
+	fs.BoolVar(&cfg.RequireEncryption, "require-encryption", cfg.RequireEncryption, "Reject unencrypted write requests, requires --crypto-key (default accepts both)")
+
+	fs.StringVar(&cfg.AdminAddress, "admin-address", cfg.AdminAddress, "Admin listener with pprof, expvar, log level, config and health: host:port or unix:/path/to.sock")
 
 	fs.StringVar(&cfg.AuditFile, "audit-file", cfg.AuditFile, "Path to audit file")
 	fs.StringVar(&cfg.AuditURL, "audit-url", cfg.AuditURL, "URL of audit endpoint")
+	fs.IntVar(&cfg.AuditQueueSize, "audit-queue-size", cfg.AuditQueueSize, "Audit events queued per sink before overflow")
+	fs.StringVar(&cfg.AuditOverflow, "audit-overflow", cfg.AuditOverflow, "What to do when an audit queue is full: drop_oldest, block or spill")
+	fs.StringVar(&cfg.AuditSpillDir, "audit-spill-dir", cfg.AuditSpillDir, "Directory for audit events spilled with --audit-overflow=spill")
+
+	fs.StringSliceVar(&cfg.ScrapeTargets, "scrape-targets", cfg.ScrapeTargets, "Comma-separated agent addresses to scrape, e.g. host:9101")
+	fs.Var(&cfg.ScrapeInterval, "scrape-interval", "Scrape interval per target (e.g. 10s)")
+	fs.Var(&cfg.ScrapeTimeout, "scrape-timeout", "Scrape request timeout (e.g. 5s)")
+	fs.Var(&cfg.ScrapeJitter, "scrape-jitter", "Max random delay before each scrape (e.g. 1s)")
+
+	fs.StringVar(&cfg.AgentConfigFile, "agent-config-file", cfg.AgentConfigFile, "JSON file with remote agent settings, empty to disable /agent-config")
+	fs.Var(&cfg.AgentSilence, "agent-silence-threshold", "Time without reports before an agent is reported silent, 0 to disable (e.g. 1m)")
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
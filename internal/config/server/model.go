@@ -3,7 +3,9 @@ package server
 import (
 	"time"
 
+	"github.com/s0n1cAK/yandex-metrics/internal/audit"
 	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
 	"go.uber.org/zap"
 )
 
@@ -14,14 +16,76 @@ type Config struct {
 	Restore       bool                `env:"RESTORE"`
 	DSN           customtype.DSN      `env:"DATABASE_DSN"`
 	HashKey       string              `env:"KEY"`
-	AuditFile     string              `env:"AUDIT_FILE"`
-	AuditURL      string              `env:"AUDIT_URL"`
-	Logger        *zap.Logger
+	// SignKeys - действующие ключи HMAC-подписи по идентификатору, пустой набор оставляет проверку HashSHA256
+	SignKeys signing.Keyring `env:"SIGN_KEYS"`
+	// SignSkew - допустимое расхождение времени подписи и часов сервера
+	SignSkew customtype.Time `env:"SIGN_SKEW"`
+	// SignKeyID - ключ из SignKeys для подписи ответов, при единственном ключе можно не задавать
+	SignKeyID string `env:"SIGN_KEY_ID"`
+	// SignExempt - пути изменяющих запросов, для которых подпись не требуется
+	SignExempt []string `env:"SIGN_EXEMPT"`
+	// TLSCert и TLSKey - сертификат и ключ сервера, при их наличии сервер принимает только HTTPS
+	TLSCert string `env:"TLS_CERT"`
+	TLSKey  string `env:"TLS_KEY"`
+	// TLSClientCA - CA сертификатов клиентов, при нем сервер требует сертификат клиента (mTLS)
+	TLSClientCA string `env:"TLS_CLIENT_CA"`
+	// TrustedSubnet - сети CIDR, из которых принимаются изменяющие запросы, пустой список не ограничивает
+	TrustedSubnet []string `env:"TRUSTED_SUBNET"`
+	// CryptoKey - PEM-файл с закрытым ключом для расшифровки запросов агентов
+	CryptoKey string `env:"CRYPTO_KEY"`
+	// RequireEncryption отклоняет незашифрованные изменяющие запросы, требует CryptoKey.
+	// По умолчанию выключен: с CryptoKey принимаются и незашифрованные запросы агентов без открытого ключа
+	RequireEncryption bool `env:"REQUIRE_ENCRYPTION"`
+	// TenantsFile - JSON-файл с настройками арендаторов: ключ HashSHA256, аудит и квоты
+	TenantsFile string `env:"TENANTS_FILE"`
+	// TokenStore - хранилище токенов доступа: путь к JSON-файлу или postgres, пустое значение отключает проверку токенов
+	TokenStore string `env:"TOKEN_STORE"`
+	// ClientRateLimit - изменяющих запросов в секунду на клиента, 0 отключает ограничение.
+	// Клиент определяется токеном, сертификатом mTLS или адресом
+	ClientRateLimit float64 `env:"CLIENT_RATE_LIMIT"`
+	// ClientRateBurst - запросов клиента сверх ClientRateLimit подряд, 0 - столько же, сколько ClientRateLimit
+	ClientRateBurst int `env:"CLIENT_RATE_BURST"`
+	// MaxMetrics - квота числа метрик арендаторов без своей квоты в TenantsFile, 0 не ограничивает
+	MaxMetrics int `env:"MAX_METRICS"`
+	// MaxClientMetrics - число разных метрик, которые может записать один клиент, 0 не ограничивает
+	MaxClientMetrics int `env:"MAX_CLIENT_METRICS"`
+	// LegacyHash разрешает запросы с HashSHA256 по ключу HashKey вместе с подписью HMAC
+	LegacyHash bool   `env:"LEGACY_HASH"`
+	AuditFile  string `env:"AUDIT_FILE"`
+	AuditURL   string `env:"AUDIT_URL"`
+	// AuditQueueSize - емкость очереди событий каждого приемника аудита
+	AuditQueueSize int `env:"AUDIT_QUEUE_SIZE"`
+	// AuditOverflow - что делать при заполненной очереди: drop_oldest, block или spill
+	AuditOverflow string `env:"AUDIT_OVERFLOW"`
+	// AuditSpillDir - каталог для событий при AuditOverflow=spill
+	AuditSpillDir string `env:"AUDIT_SPILL_DIR"`
+	// ScrapeTargets - адреса агентов в режиме pull, которые опрашивает сервер
+	ScrapeTargets  []string        `env:"SCRAPE_TARGETS"`
+	ScrapeInterval customtype.Time `env:"SCRAPE_INTERVAL"`
+	ScrapeTimeout  customtype.Time `env:"SCRAPE_TIMEOUT"`
+	ScrapeJitter   customtype.Time `env:"SCRAPE_JITTER"`
+	// AgentSilence - время без отчетов, после которого агент считается пропавшим, 0 отключает оповещения
+	AgentSilence customtype.Time `env:"AGENT_SILENCE_THRESHOLD"`
+	// AgentConfigFile - JSON-файл с настройками агентов, раздаваемыми через /agent-config
+	AgentConfigFile string `env:"AGENT_CONFIG_FILE"`
+	// AdminAddress - адрес служебного сервера с pprof, expvar, уровнем логов, настройками и состоянием:
+	// host:port или unix:/path/to.sock, пустой отключает его
+	AdminAddress string      `env:"ADMIN_ADDRESS"`
+	Logger       *zap.Logger `json:"-"`
+	// LogLevel - уровень Logger, который можно менять через служебный сервер; nil если менять нельзя
+	LogLevel *zap.AtomicLevel `json:"-"`
 }
 
 var (
-	DefaultEndpoint      = customtype.Endpoint("http://localhost:8080")
-	DefaultStoreInterval = customtype.Time(300 * time.Second)
-	DefaultFile          = "Metrics.data"
-	DefaultRestore       = true
+	DefaultEndpoint       = customtype.Endpoint("http://localhost:8080")
+	DefaultStoreInterval  = customtype.Time(300 * time.Second)
+	DefaultFile           = "Metrics.data"
+	DefaultRestore        = true
+	DefaultScrapeInterval = customtype.Time(10 * time.Second)
+	DefaultScrapeTimeout  = customtype.Time(5 * time.Second)
+	DefaultScrapeJitter   = customtype.Time(time.Second)
+	DefaultAgentSilence   = customtype.Time(time.Minute)
+	DefaultSignSkew       = customtype.Time(signing.DefaultSkew)
+	DefaultAuditQueueSize = audit.DefaultQueueSize
+	DefaultAuditOverflow  = string(audit.DefaultOverflow)
 )
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"maps"
+	"net/url"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
+)
+
+// redacted заменяет значения секретов в Redact
+const redacted = "[redacted]"
+
+// Redact возвращает копию cfg без секретов для вывода: ключей подписи, пароля базы данных,
+// учетных данных и значений параметров в адресе аудита. Пути к файлам с секретами остаются.
+func Redact(cfg Config) Config {
+	if cfg.HashKey != "" {
+		cfg.HashKey = redacted
+	}
+	if len(cfg.SignKeys) > 0 {
+		keys := make(signing.Keyring, len(cfg.SignKeys))
+		for id := range maps.Keys(cfg.SignKeys) {
+			keys[id] = redacted
+		}
+		cfg.SignKeys = keys
+	}
+	if cfg.DSN.Password != "" {
+		cfg.DSN.Password = redacted
+	}
+	if cfg.AuditURL != "" {
+		cfg.AuditURL = redactURL(cfg.AuditURL)
+	}
+	return cfg
+}
+
+// redactURL скрывает в адресе учетные данные и значения параметров, например ?token=...
+// Адрес, который не удалось разобрать, скрывается целиком.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{redacted}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
@@ -1,11 +1,27 @@
 package server
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/audit"
+)
 
 var (
 	ErrEmptyEndpoint = errors.New("endpoint is empty")
 	ErrBadStore      = errors.New("store interval must be > 0")
 	ErrEmptyFile     = errors.New("file path is empty while restore enabled")
+	ErrBadScrape     = errors.New("scrape interval must be > 0 and timeout, jitter >= 0")
+	ErrBadSignSkew   = errors.New("sign skew must be > 0")
+	ErrBadSignKeyID  = errors.New("sign key id is not in sign keys")
+	ErrBadTLS        = errors.New("tls cert and key must be set together, client CA requires them")
+	ErrBadSubnet     = errors.New("trusted subnet must be a list of CIDR")
+	ErrBadLimits     = errors.New("client rate limit, burst and metric quotas must be >= 0")
+	ErrBadAdmin      = errors.New("admin address must be host:port or unix:/path, tcp on non-loopback host requires token store")
+	ErrBadCrypto     = errors.New("require encryption needs crypto key")
 )
 
 func ValidateConfig(cfg Config) error {
@@ -18,5 +34,85 @@ func ValidateConfig(cfg Config) error {
 	if cfg.Restore && cfg.File == "" {
 		return ErrEmptyFile
 	}
+	if len(cfg.ScrapeTargets) > 0 && (cfg.ScrapeInterval.Duration() <= 0 || cfg.ScrapeTimeout.Duration() < 0 || cfg.ScrapeJitter.Duration() < 0) {
+		return ErrBadScrape
+	}
+	if len(cfg.SignKeys) > 0 && cfg.SignSkew.Duration() <= 0 {
+		return ErrBadSignSkew
+	}
+	if _, ok := cfg.SignKeys[cfg.SignKeyID]; cfg.SignKeyID != "" && !ok {
+		return ErrBadSignKeyID
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") || (cfg.TLSClientCA != "" && cfg.TLSCert == "") {
+		return ErrBadTLS
+	}
+	if _, err := ParseSubnets(cfg.TrustedSubnet); err != nil {
+		return err
+	}
+	if cfg.RequireEncryption && cfg.CryptoKey == "" {
+		return ErrBadCrypto
+	}
+	if cfg.ClientRateLimit < 0 || cfg.ClientRateBurst < 0 || cfg.MaxMetrics < 0 || cfg.MaxClientMetrics < 0 {
+		return ErrBadLimits
+	}
+	if _, _, err := AdminListener(cfg); err != nil {
+		return err
+	}
+	if err := AuditOptions(cfg).Validate(); err != nil {
+		return err
+	}
 	return nil
 }
+
+// AuditOptions возвращает настройки очередей аудита.
+func AuditOptions(cfg Config) audit.Options {
+	return audit.Options{
+		QueueSize: cfg.AuditQueueSize,
+		Overflow:  audit.OverflowPolicy(cfg.AuditOverflow),
+		SpillDir:  cfg.AuditSpillDir,
+	}
+}
+
+// AdminListener возвращает сеть и адрес служебного сервера из AdminAddress, пустые если он отключен.
+// Служебный сервер по TCP доступен только с loopback-адреса, если токены доступа не включены.
+func AdminListener(cfg Config) (string, string, error) {
+	switch {
+	case cfg.AdminAddress == "":
+		return "", "", nil
+	case strings.HasPrefix(cfg.AdminAddress, "unix:"):
+		path := strings.TrimPrefix(cfg.AdminAddress, "unix:")
+		if path == "" {
+			return "", "", ErrBadAdmin
+		}
+		return "unix", path, nil
+	}
+
+	host, _, err := net.SplitHostPort(cfg.AdminAddress)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrBadAdmin, err)
+	}
+	if cfg.TokenStore == "" && host != "localhost" {
+		ip, err := netip.ParseAddr(host)
+		if err != nil || !ip.IsLoopback() {
+			return "", "", fmt.Errorf("%w: %q", ErrBadAdmin, cfg.AdminAddress)
+		}
+	}
+	return "tcp", cfg.AdminAddress, nil
+}
+
+// ParseSubnets разбирает список сетей CIDR.
+func ParseSubnets(subnets []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(subnets))
+	for _, subnet := range subnets {
+		subnet = strings.TrimSpace(subnet)
+		if subnet == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrBadSubnet, subnet)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -65,3 +65,46 @@ func (e *Endpoint) HostPort() string {
 	}
 	return u.Host
 }
+
+// Endpoints - список адресов, заданный через запятую.
+type Endpoints []Endpoint
+
+func (e *Endpoints) String() string {
+	if e == nil {
+		return ""
+	}
+
+	items := make([]string, 0, len(*e))
+	for _, endpoint := range *e {
+		items = append(items, string(endpoint))
+	}
+	return strings.Join(items, ",")
+}
+
+func (e *Endpoints) Type() string {
+	return "endpoints"
+}
+
+func (e *Endpoints) Set(value string) error {
+	var result Endpoints
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		endpoint, err := formatEndpoint(item)
+		if err != nil {
+			return err
+		}
+		result = append(result, endpoint)
+	}
+	if len(result) == 0 {
+		return errors.New("endpoint list is empty")
+	}
+	*e = result
+	return nil
+}
+
+func (e *Endpoints) UnmarshalText(text []byte) error {
+	return e.Set(string(text))
+}
@@ -64,3 +64,7 @@ func (ct *Time) UnmarshalText(text []byte) error {
 	*ct = gValue
 	return nil
 }
+
+func (ct Time) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(ct).String()), nil
+}
@@ -7,4 +7,5 @@ var (
 	ErrInvalidType    = errors.New("invalid metric type")
 	ErrInvalidPayload = errors.New("invalid payload")
 	ErrZeroCounter    = errors.New("counter cannot be zero")
+	ErrQuotaExceeded  = errors.New("metrics quota exceeded")
 )
@@ -0,0 +1,281 @@
+// Package encryption шифрует тела запросов агента открытым ключом сервера.
+//
+// Каждое тело шифруется AES-256-GCM новым симметричным ключом. Ключ передается вместе с телом:
+// для RSA он зашифрован RSA-OAEP (SHA-256), для ECDH выводится через HKDF-SHA256 из общего секрета
+// с одноразовым ключом агента. Схема передается в заголовке HeaderScheme.
+//
+// Формат тела: длина служебной части (2 байта, big endian), служебная часть
+// (зашифрованный ключ RSA или открытый одноразовый ключ ECDH), nonce GCM, шифротекст.
+package encryption
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// HeaderScheme - заголовок со схемой шифрования тела запроса
+const HeaderScheme = "X-Encryption"
+
+// Схемы шифрования. Версия в имени меняется при несовместимом изменении формата.
+const (
+	SchemeRSA  = "rsa-oaep-aes256gcm-v1"
+	SchemeECDH = "ecdh-hkdf-aes256gcm-v1"
+)
+
+const keySize = 32
+
+var (
+	ErrBadKey            = errors.New("unsupported or malformed key")
+	ErrUnsupportedScheme = errors.New("unsupported encryption scheme")
+	ErrBadCiphertext     = errors.New("malformed ciphertext")
+)
+
+// Encrypter шифрует данные открытым ключом сервера.
+type Encrypter struct {
+	scheme string
+	rsa    *rsa.PublicKey
+	ecdh   *ecdh.PublicKey
+}
+
+// LoadPublicKey читает открытый ключ сервера из PEM-файла (PUBLIC KEY или RSA PUBLIC KEY).
+func LoadPublicKey(path string) (*Encrypter, error) {
+	op := "encryption.LoadPublicKey"
+
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrBadKey, err)
+	}
+
+	e, err := NewEncrypter(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return e, nil
+}
+
+// NewEncrypter создает шифрование ключом *rsa.PublicKey, *ecdsa.PublicKey или *ecdh.PublicKey.
+func NewEncrypter(key crypto.PublicKey) (*Encrypter, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &Encrypter{scheme: SchemeRSA, rsa: k}, nil
+	case *ecdsa.PublicKey:
+		pub, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadKey, err)
+		}
+		return &Encrypter{scheme: SchemeECDH, ecdh: pub}, nil
+	case *ecdh.PublicKey:
+		return &Encrypter{scheme: SchemeECDH, ecdh: k}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrBadKey, key)
+}
+
+// Scheme возвращает схему для заголовка HeaderScheme.
+func (e *Encrypter) Scheme() string {
+	return e.scheme
+}
+
+// Encrypt шифрует plain новым симметричным ключом.
+func (e *Encrypter) Encrypt(plain []byte) ([]byte, error) {
+	var (
+		key    []byte
+		header []byte
+		err    error
+	)
+
+	switch e.scheme {
+	case SchemeRSA:
+		key = make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		header, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, e.rsa, key, []byte(e.scheme))
+		if err != nil {
+			return nil, err
+		}
+	case SchemeECDH:
+		ephemeral, err := e.ecdh.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		header = ephemeral.PublicKey().Bytes()
+		key, err = deriveKey(ephemeral, e.ecdh, header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 2, 2+len(header)+len(nonce)+len(plain)+aead.Overhead())
+	binary.BigEndian.PutUint16(out, uint16(len(header)))
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, []byte(e.scheme)), nil
+}
+
+// Decrypter расшифровывает данные закрытым ключом сервера.
+type Decrypter struct {
+	rsa  *rsa.PrivateKey
+	ecdh *ecdh.PrivateKey
+}
+
+// LoadPrivateKey читает закрытый ключ сервера из PEM-файла (PRIVATE KEY, RSA PRIVATE KEY или EC PRIVATE KEY).
+func LoadPrivateKey(path string) (*Decrypter, error) {
+	op := "encryption.LoadPrivateKey"
+
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var key crypto.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrBadKey, err)
+	}
+
+	d, err := NewDecrypter(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return d, nil
+}
+
+// NewDecrypter создает расшифровку ключом *rsa.PrivateKey, *ecdsa.PrivateKey или *ecdh.PrivateKey.
+func NewDecrypter(key crypto.PrivateKey) (*Decrypter, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &Decrypter{rsa: k}, nil
+	case *ecdsa.PrivateKey:
+		priv, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadKey, err)
+		}
+		return &Decrypter{ecdh: priv}, nil
+	case *ecdh.PrivateKey:
+		return &Decrypter{ecdh: k}, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrBadKey, key)
+}
+
+// Decrypt расшифровывает data, зашифрованные по схеме scheme.
+func (d *Decrypter) Decrypt(scheme string, data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, ErrBadCiphertext
+	}
+	size := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < size {
+		return nil, ErrBadCiphertext
+	}
+	header, data := data[:size], data[size:]
+
+	var (
+		key []byte
+		err error
+	)
+
+	switch {
+	case scheme == SchemeRSA && d.rsa != nil:
+		key, err = rsa.DecryptOAEP(sha256.New(), nil, d.rsa, header, []byte(scheme))
+		if err != nil {
+			return nil, ErrBadCiphertext
+		}
+	case scheme == SchemeECDH && d.ecdh != nil:
+		ephemeral, err := d.ecdh.Curve().NewPublicKey(header)
+		if err != nil {
+			return nil, ErrBadCiphertext
+		}
+		key, err = deriveKey(d.ecdh, ephemeral, header)
+		if err != nil {
+			return nil, ErrBadCiphertext
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, scheme)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrBadCiphertext
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(scheme))
+	if err != nil {
+		return nil, ErrBadCiphertext
+	}
+	return plain, nil
+}
+
+// deriveKey выводит симметричный ключ из общего секрета ECDH.
+// Открытый одноразовый ключ входит в контекст, чтобы ключ был привязан к конкретному сообщению.
+func deriveKey(priv *ecdh.PrivateKey, pub *ecdh.PublicKey, ephemeral []byte) ([]byte, error) {
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	return hkdf.Key(sha256.New, secret, ephemeral, SchemeECDH, keySize)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block in %s", ErrBadKey, path)
+	}
+	return block, nil
+}
@@ -0,0 +1,102 @@
+package encryption
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeys сохраняет пару ключей в PEM-файлы, как их выпускает openssl.
+func writeKeys(t *testing.T, priv any, pub any) (string, string) {
+	t.Helper()
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "server.key")
+	pubPath := filepath.Join(dir, "server.pub")
+
+	require.NoError(t, os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600))
+	require.NoError(t, os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644))
+
+	return privPath, pubPath
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	xKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		priv   any
+		pub    any
+		scheme string
+	}{
+		{name: "rsa", priv: rsaKey, pub: &rsaKey.PublicKey, scheme: SchemeRSA},
+		{name: "ecdh p256", priv: ecKey, pub: &ecKey.PublicKey, scheme: SchemeECDH},
+		{name: "ecdh x25519", priv: xKey, pub: xKey.PublicKey(), scheme: SchemeECDH},
+	}
+
+	plain := []byte(`[{"id":"PollCount","type":"counter","delta":5}]`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privPath, pubPath := writeKeys(t, tt.priv, tt.pub)
+
+			enc, err := LoadPublicKey(pubPath)
+			require.NoError(t, err)
+			require.Equal(t, tt.scheme, enc.Scheme())
+
+			dec, err := LoadPrivateKey(privPath)
+			require.NoError(t, err)
+
+			data, err := enc.Encrypt(plain)
+			require.NoError(t, err)
+			require.NotContains(t, string(data), "PollCount")
+
+			got, err := dec.Decrypt(enc.Scheme(), data)
+			require.NoError(t, err)
+			require.Equal(t, plain, got)
+
+			// Измененный шифротекст не расшифровывается
+			data[len(data)-1] ^= 0xff
+			_, err = dec.Decrypt(enc.Scheme(), data)
+			require.ErrorIs(t, err, ErrBadCiphertext)
+		})
+	}
+}
+
+func TestDecrypt_WrongScheme(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	enc, err := NewEncrypter(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	dec, err := NewDecrypter(rsaKey)
+	require.NoError(t, err)
+
+	data, err := enc.Encrypt([]byte("metrics"))
+	require.NoError(t, err)
+
+	_, err = dec.Decrypt(SchemeECDH, data)
+	require.ErrorIs(t, err, ErrUnsupportedScheme)
+
+	_, err = dec.Decrypt(SchemeRSA, data[:3])
+	require.ErrorIs(t, err, ErrBadCiphertext)
+}
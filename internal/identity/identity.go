@@ -0,0 +1,180 @@
+// Package identity описывает идентификацию агента в запросах к серверу.
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Заголовки, которыми агент представляется серверу
+const (
+	HeaderID        = "X-Agent-ID"
+	HeaderHostname  = "X-Agent-Hostname"
+	HeaderVersion   = "X-Agent-Version"
+	HeaderStartTime = "X-Agent-Start-Time"
+	HeaderGroup     = "X-Agent-Group"
+)
+
+// Version - версия агента, задается при сборке через -ldflags "-X ...identity.Version=v1.2.3"
+var Version = "dev"
+
+// Identity - сведения об экземпляре агента.
+type Identity struct {
+	// ID - идентификатор экземпляра, сохраняется между перезапусками
+	ID string `json:"id"`
+	// Hostname - имя хоста агента
+	Hostname string `json:"hostname"`
+	// Version - версия агента
+	Version string `json:"version"`
+	// StartedAt - время запуска агента
+	StartedAt time.Time `json:"started_at"`
+	// Group - группа агента, по которой сервер выбирает его настройки
+	Group string `json:"group,omitempty"`
+}
+
+// Load возвращает идентичность текущего процесса.
+// ID читается из файла path, при его отсутствии генерируется и сохраняется.
+// Пустой path дает новый ID при каждом запуске.
+func Load(path string) (Identity, error) {
+	op := "identity.Load"
+
+	id, err := loadID(path)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return Identity{
+		ID:        id,
+		Hostname:  hostname,
+		Version:   Version,
+		StartedAt: time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+func loadID(path string) (string, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id, nil
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// SetHeaders добавляет идентичность в заголовки запроса.
+func (i Identity) SetHeaders(h http.Header) {
+	if i.ID == "" {
+		return
+	}
+	h.Set(HeaderID, i.ID)
+	h.Set(HeaderHostname, i.Hostname)
+	h.Set(HeaderVersion, i.Version)
+	h.Set(HeaderStartTime, i.StartedAt.Format(time.RFC3339))
+	if i.Group != "" {
+		h.Set(HeaderGroup, i.Group)
+	}
+}
+
+// FromHeaders читает идентичность из заголовков запроса. Без X-Agent-ID возвращает false.
+func FromHeaders(h http.Header) (Identity, bool) {
+	id := h.Get(HeaderID)
+	if id == "" {
+		return Identity{}, false
+	}
+
+	started, _ := time.Parse(time.RFC3339, h.Get(HeaderStartTime))
+
+	return Identity{
+		ID:        id,
+		Hostname:  h.Get(HeaderHostname),
+		Version:   h.Get(HeaderVersion),
+		StartedAt: started,
+		Group:     h.Get(HeaderGroup),
+	}, true
+}
+
+type ctxKey struct{}
+
+// WithContext сохраняет идентичность в контексте запроса.
+func WithContext(ctx context.Context, i Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, i)
+}
+
+// FromContext возвращает идентичность, сохраненную WithContext.
+func FromContext(ctx context.Context) (Identity, bool) {
+	i, ok := ctx.Value(ctxKey{}).(Identity)
+	return i, ok
+}
+
+type peerKey struct{}
+
+// WithPeer сохраняет в контексте имя из сертификата клиента mTLS.
+func WithPeer(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, peerKey{}, name)
+}
+
+// PeerFromContext возвращает имя, сохраненное WithPeer.
+func PeerFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(peerKey{}).(string)
+	return name, ok
+}
+
+type socketKey struct{}
+
+// WithSocketAddr сохраняет в контексте адрес, с которого установлено соединение.
+// В отличие от RemoteAddr после middleware.RealIP, его нельзя подменить заголовками.
+func WithSocketAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, socketKey{}, addr)
+}
+
+// SocketAddrFromContext возвращает адрес, сохраненный WithSocketAddr.
+func SocketAddrFromContext(ctx context.Context) (string, bool) {
+	addr, ok := ctx.Value(socketKey{}).(string)
+	return addr, ok
+}
+
+type clientKey struct{}
+
+// WithClient сохраняет в контексте ключ клиента, по которому сервер ограничивает его запросы.
+func WithClient(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, clientKey{}, key)
+}
+
+// ClientFromContext возвращает ключ клиента, сохраненный WithClient, или пустую строку.
+func ClientFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(clientKey{}).(string)
+	return key
+}
@@ -0,0 +1,40 @@
+package identity
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_PersistsID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.id")
+
+	first, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, first.ID, 32)
+
+	second, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, first.ID, second.ID)
+
+	ephemeral, err := Load("")
+	require.NoError(t, err)
+	require.NotEqual(t, first.ID, ephemeral.ID)
+}
+
+func TestHeaders(t *testing.T) {
+	id, err := Load("")
+	require.NoError(t, err)
+
+	h := http.Header{}
+	id.SetHeaders(h)
+
+	got, ok := FromHeaders(h)
+	require.True(t, ok)
+	require.Equal(t, id, got)
+
+	_, ok = FromHeaders(http.Header{})
+	require.False(t, ok)
+}
@@ -0,0 +1,214 @@
+// Package inventory ведет учет агентов, отправляющих метрики на сервер.
+package inventory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// EventAgentSilent - событие аудита о пропавшем агенте
+const EventAgentSilent = "agent_silent"
+
+var (
+	// DefaultMaxAgents - предел числа агентов в реестре. ID агента присылает клиент,
+	// поэтому без предела реестр можно раздуть запросами с разными ID
+	DefaultMaxAgents = 10000
+	// DefaultRetention - агент, молчащий дольше, удаляется из реестра
+	DefaultRetention = 7 * 24 * time.Hour
+)
+
+// Publisher публикует события аудита. Реализуется audit.AuditPublisher.
+type Publisher interface {
+	Publish(event models.AuditEvent) error
+}
+
+// Agent - состояние агента в реестре.
+type Agent struct {
+	identity.Identity
+	// IPAddress - адрес последнего запроса
+	IPAddress string `json:"ip_address"`
+	// FirstSeen и LastSeen - время первого и последнего запроса
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Reports - число запросов, Errors - из них завершившихся ошибкой
+	Reports int64 `json:"reports"`
+	Errors  int64 `json:"errors"`
+	// Silent - агент не присылал данные дольше порога
+	Silent bool `json:"silent"`
+}
+
+// Inventory - реестр агентов.
+type Inventory struct {
+	mu        sync.Mutex
+	agents    map[string]*Agent
+	threshold time.Duration
+	publisher Publisher
+	log       *zap.Logger
+	now       func() time.Time
+	maxAgents int
+	retention time.Duration
+}
+
+// New создает реестр. Агент считается пропавшим, если молчит дольше threshold.
+// Нулевой threshold отключает оповещения.
+func New(threshold time.Duration, publisher Publisher, log *zap.Logger) *Inventory {
+	return &Inventory{
+		agents:    make(map[string]*Agent),
+		threshold: threshold,
+		publisher: publisher,
+		log:       log,
+		now:       time.Now,
+		maxAgents: DefaultMaxAgents,
+		retention: DefaultRetention,
+	}
+}
+
+// Observe учитывает отчет агента. Агент попадает в реестр только с успешным отчетом,
+// ошибки учитываются у уже известных агентов.
+func (inv *Inventory) Observe(id identity.Identity, ip string, failed bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	agent, ok := inv.touch(id, ip, !failed)
+	if !ok {
+		return
+	}
+	agent.Reports++
+	if failed {
+		agent.Errors++
+	}
+}
+
+// Touch обновляет время последнего обращения известного агента без учета отчета, например при проверке /ping.
+func (inv *Inventory) Touch(id identity.Identity, ip string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.touch(id, ip, false)
+}
+
+// touch обновляет агента, а при add добавляет неизвестного. Возвращает false, если агента нет в реестре.
+func (inv *Inventory) touch(id identity.Identity, ip string, add bool) (*Agent, bool) {
+	now := inv.now()
+
+	agent, ok := inv.agents[id.ID]
+	if !ok {
+		if !add {
+			return nil, false
+		}
+		inv.evict(now)
+		agent = &Agent{FirstSeen: now}
+		inv.agents[id.ID] = agent
+	}
+
+	agent.Identity = id
+	agent.IPAddress = ip
+	agent.LastSeen = now
+	agent.Silent = false
+
+	return agent, true
+}
+
+// evict освобождает место для нового агента: удаляет молчащих дольше retention,
+// а если реестр все еще заполнен - дольше всех молчащего.
+func (inv *Inventory) evict(now time.Time) {
+	if len(inv.agents) < inv.maxAgents {
+		return
+	}
+
+	var oldest string
+	for id, agent := range inv.agents {
+		if now.Sub(agent.LastSeen) > inv.retention {
+			delete(inv.agents, id)
+			continue
+		}
+		if oldest == "" || agent.LastSeen.Before(inv.agents[oldest].LastSeen) {
+			oldest = id
+		}
+	}
+
+	if len(inv.agents) >= inv.maxAgents {
+		delete(inv.agents, oldest)
+	}
+}
+
+// List возвращает агентов, отсортированных по ID.
+func (inv *Inventory) List() []Agent {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	result := make([]Agent, 0, len(inv.agents))
+	for _, agent := range inv.agents {
+		result = append(result, *agent)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
+
+// Watch проверяет агентов до отмены ctx и публикует событие для каждого пропавшего.
+// Повторное событие публикуется только после того, как агент снова вышел на связь.
+func (inv *Inventory) Watch(ctx context.Context) {
+	if inv.threshold <= 0 {
+		return
+	}
+
+	interval := max(inv.threshold/4, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, event := range inv.check() {
+				inv.log.Warn("Agent went silent", zap.String("agent_id", event.AgentID), zap.String("hostname", event.Hostname))
+				if inv.publisher == nil {
+					continue
+				}
+				if err := inv.publisher.Publish(event); err != nil {
+					inv.log.Error("Failed to publish audit event", zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// check отмечает пропавших агентов и возвращает события о них.
+func (inv *Inventory) check() []models.AuditEvent {
+	now := inv.now()
+
+	var events []models.AuditEvent
+
+	inv.mu.Lock()
+	for id, agent := range inv.agents {
+		if now.Sub(agent.LastSeen) > inv.retention {
+			delete(inv.agents, id)
+			continue
+		}
+		if agent.Silent || now.Sub(agent.LastSeen) <= inv.threshold {
+			continue
+		}
+		agent.Silent = true
+		events = append(events, models.AuditEvent{
+			TS:        now.Unix(),
+			IPAddress: agent.IPAddress,
+			Event:     EventAgentSilent,
+			AgentID:   agent.ID,
+			Hostname:  agent.Hostname,
+		})
+	}
+	inv.mu.Unlock()
+
+	return events
+}
@@ -0,0 +1,71 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestInventory(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	inv := New(time.Minute, nil, zap.NewNop())
+	inv.now = func() time.Time { return now }
+
+	agent := identity.Identity{ID: "a1", Hostname: "web-1", Version: "v1"}
+	inv.Observe(agent, "10.0.0.1", false)
+	inv.Observe(agent, "10.0.0.1", true)
+	inv.Observe(identity.Identity{ID: "b2"}, "10.0.0.2", false)
+
+	// Неизвестный агент не попадает в реестр без успешного отчета
+	inv.Observe(identity.Identity{ID: "c3"}, "10.0.0.3", true)
+	inv.Touch(identity.Identity{ID: "d4"}, "10.0.0.4")
+
+	list := inv.List()
+	require.Len(t, list, 2)
+	require.Equal(t, "a1", list[0].ID)
+	require.Equal(t, int64(2), list[0].Reports)
+	require.Equal(t, int64(1), list[0].Errors)
+	require.Equal(t, int64(1), list[1].Reports)
+
+	now = now.Add(30 * time.Second)
+	require.Empty(t, inv.check())
+
+	now = now.Add(time.Minute)
+	events := inv.check()
+	require.Len(t, events, 2)
+	require.Equal(t, EventAgentSilent, events[0].Event)
+
+	// Событие о пропавшем агенте не повторяется
+	require.Empty(t, inv.check())
+
+	inv.Observe(agent, "10.0.0.1", false)
+	require.False(t, inv.List()[0].Silent)
+}
+
+func TestInventory_Limits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	inv := New(time.Minute, nil, zap.NewNop())
+	inv.now = func() time.Time { return now }
+	inv.maxAgents = 2
+	inv.retention = time.Hour
+
+	inv.Observe(identity.Identity{ID: "a1"}, "10.0.0.1", false)
+	now = now.Add(time.Second)
+	inv.Observe(identity.Identity{ID: "b2"}, "10.0.0.2", false)
+	now = now.Add(time.Second)
+
+	// В заполненном реестре вытесняется дольше всех молчащий агент
+	inv.Observe(identity.Identity{ID: "c3"}, "10.0.0.3", false)
+	list := inv.List()
+	require.Len(t, list, 2)
+	require.Equal(t, "b2", list[0].ID)
+	require.Equal(t, "c3", list[1].ID)
+
+	// Агенты, молчащие дольше retention, удаляются
+	now = now.Add(2 * time.Hour)
+	inv.check()
+	require.Empty(t, inv.List())
+}
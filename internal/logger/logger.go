@@ -5,12 +5,18 @@ import (
 )
 
 func NewLogger() (*zap.Logger, error) {
+	l, _, err := New()
+	return l, err
+}
+
+// New создает логгер и возвращает его уровень, который можно менять во время работы.
+func New() (*zap.Logger, zap.AtomicLevel, error) {
 	cfg := zap.NewDevelopmentConfig()
 
 	l, err := cfg.Build()
 	if err != nil {
-		return nil, err
+		return nil, zap.AtomicLevel{}, err
 	}
 
-	return l, nil
+	return l, cfg.Level, nil
 }
@@ -4,4 +4,18 @@ type AuditEvent struct {
 	TS        int64     `json:"ts"`
 	Metrics   []Metrics `json:"metrics"`
 	IPAddress string    `json:"ip_address"`
+	// Event - тип события, пустой для записи метрик
+	Event string `json:"event,omitempty"`
+	// AgentID и Hostname - идентичность агента, если он ее передал
+	AgentID  string `json:"agent_id,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	// ClientCert - имя из сертификата клиента mTLS, при нем IPAddress не заполняется
+	ClientCert string `json:"client_cert,omitempty"`
+	// Tenant - арендатор, к которому относится событие
+	Tenant string `json:"tenant,omitempty"`
+	// TokenID и TokenName - токен доступа, с которым выполнен запрос
+	TokenID   string `json:"token_id,omitempty"`
+	TokenName string `json:"token_name,omitempty"`
+	// Reason - причина отказа для событий об отклоненных запросах
+	Reason string `json:"reason,omitempty"`
 }
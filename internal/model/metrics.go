@@ -25,4 +25,6 @@ type Metrics struct {
 	Value *float64 `json:"value,omitempty"`
 	// Hash - хеш-значение для проверки целостности (опционально)
 	Hash string `json:"hash,omitempty"`
+	// Tenant - арендатор метрики, заполняется хранилищем; пустой у арендатора по умолчанию
+	Tenant string `json:"tenant,omitempty"`
 }
@@ -0,0 +1,235 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+)
+
+const fileExt = ".json"
+
+// QuarantineDir - подкаталог очереди для пакетов, которые сервер отклонил окончательно
+const QuarantineDir = "quarantine"
+
+var ErrTooLarge = errors.New("batch is larger than outbox size limit")
+
+// Outbox - очередь неотправленных пакетов метрик на диске.
+// Каждый пакет хранится в отдельном файле, имя которого задает порядок воспроизведения.
+// При превышении лимита размера удаляются самые старые пакеты,
+// пакеты старше maxAge отбрасываются.
+type Outbox struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+	seq      uint64
+	dropped  atomic.Int64
+	mu       sync.Mutex
+}
+
+// Entry - пакет, извлеченный из очереди.
+type Entry struct {
+	// Name - имя файла пакета, используется для удаления после отправки
+	Name string
+	// CreatedAt - время помещения пакета в очередь
+	CreatedAt time.Time
+	// Metrics - содержимое пакета
+	Metrics []models.Metrics
+}
+
+type entryInfo struct {
+	name    string
+	size    int64
+	created time.Time
+}
+
+// New создает очередь в каталоге dir. Нулевые maxBytes и maxAge отключают соответствующий лимит.
+func New(dir string, maxBytes int64, maxAge time.Duration) (*Outbox, error) {
+	op := "outbox.New"
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Outbox{dir: dir, maxBytes: maxBytes, maxAge: maxAge}, nil
+}
+
+// Push добавляет пакет в конец очереди.
+func (o *Outbox) Push(batch []models.Metrics) error {
+	op := "outbox.Push"
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := o.push(data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// PushJSON добавляет в конец очереди пакет, уже сериализованный в JSON.
+func (o *Outbox) PushJSON(data []byte) error {
+	if err := o.push(data); err != nil {
+		return fmt.Errorf("outbox.PushJSON: %w", err)
+	}
+	return nil
+}
+
+func (o *Outbox) push(data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.maxBytes > 0 && int64(len(data)) > o.maxBytes {
+		return ErrTooLarge
+	}
+
+	entries, err := o.list()
+	if err != nil {
+		return err
+	}
+
+	if o.maxBytes > 0 {
+		var total int64
+		for _, e := range entries {
+			total += e.size
+		}
+		for len(entries) > 0 && total+int64(len(data)) > o.maxBytes {
+			if err := os.Remove(filepath.Join(o.dir, entries[0].name)); err != nil {
+				return err
+			}
+			total -= entries[0].size
+			o.dropped.Add(1)
+			entries = entries[1:]
+		}
+	}
+
+	o.seq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), o.seq%1000000, fileExt)
+	tmp := filepath.Join(o.dir, name+".tmp")
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(o.dir, name)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Oldest возвращает самый старый пакет, не удаляя его из очереди.
+func (o *Outbox) Oldest() (Entry, bool, error) {
+	op := "outbox.Oldest"
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.list()
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(entries) == 0 {
+		return Entry{}, false, nil
+	}
+
+	e := entries[0]
+	data, err := os.ReadFile(filepath.Join(o.dir, e.name))
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var batch []models.Metrics
+	if err := json.Unmarshal(data, &batch); err != nil {
+		// Поврежденный файл не должен блокировать очередь
+		_ = os.Remove(filepath.Join(o.dir, e.name))
+		return Entry{}, false, fmt.Errorf("%s: corrupted entry %s: %w", op, e.name, err)
+	}
+
+	return Entry{Name: e.name, CreatedAt: e.created, Metrics: batch}, true, nil
+}
+
+// Remove удаляет пакет из очереди.
+func (o *Outbox) Remove(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	err := os.Remove(filepath.Join(o.dir, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("outbox.Remove: %w", err)
+	}
+	return nil
+}
+
+// Quarantine убирает пакет из очереди в подкаталог QuarantineDir,
+// где он хранится для разбора и не мешает отправке следующих пакетов.
+func (o *Outbox) Quarantine(name string) error {
+	op := "outbox.Quarantine"
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	dir := filepath.Join(o.dir, QuarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := os.Rename(filepath.Join(o.dir, name), filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Len возвращает количество пакетов в очереди.
+func (o *Outbox) Len() (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.list()
+	return len(entries), err
+}
+
+// Dropped возвращает число пакетов, удаленных из-за лимитов размера и возраста.
+func (o *Outbox) Dropped() int64 {
+	return o.dropped.Load()
+}
+
+// list возвращает пакеты в порядке добавления, попутно удаляя просроченные.
+func (o *Outbox) list() ([]entryInfo, error) {
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entryInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+
+		if o.maxAge > 0 && time.Since(info.ModTime()) > o.maxAge {
+			_ = os.Remove(filepath.Join(o.dir, f.Name()))
+			o.dropped.Add(1)
+			continue
+		}
+
+		entries = append(entries, entryInfo{name: f.Name(), size: info.Size(), created: info.ModTime()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	return entries, nil
+}
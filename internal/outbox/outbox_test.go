@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func batch(id string) []models.Metrics {
+	return []models.Metrics{{ID: id, MType: models.Gauge, Value: lib.FloatPtr(1)}}
+}
+
+func TestOutbox_Order(t *testing.T) {
+	o, err := New(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	for _, id := range []string{"first", "second", "third"} {
+		require.NoError(t, o.Push(batch(id)))
+	}
+
+	for _, want := range []string{"first", "second", "third"} {
+		e, ok, err := o.Oldest()
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, want, e.Metrics[0].ID)
+		require.NoError(t, o.Remove(e.Name))
+	}
+
+	_, ok, err := o.Oldest()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestOutbox_SizeLimit(t *testing.T) {
+	o, err := New(t.TempDir(), 100, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, o.Push(batch("first")))
+	require.NoError(t, o.Push(batch("second")))
+	require.NoError(t, o.Push(batch("third")))
+
+	n, err := o.Len()
+	require.NoError(t, err)
+	require.Less(t, n, 3)
+
+	e, ok, err := o.Oldest()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotEqual(t, "first", e.Metrics[0].ID)
+
+	require.ErrorIs(t, o.Push(make([]models.Metrics, 100)), ErrTooLarge)
+}
+
+func TestOutbox_MaxAge(t *testing.T) {
+	o, err := New(t.TempDir(), 0, time.Millisecond)
+	require.NoError(t, err)
+
+	require.NoError(t, o.Push(batch("stale")))
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok, err := o.Oldest()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
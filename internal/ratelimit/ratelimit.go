@@ -0,0 +1,91 @@
+// Package ratelimit ограничивает частоту запросов каждого клиента сервера алгоритмом token bucket.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Result - решение по запросу клиента.
+type Result struct {
+	// Allowed - запрос можно выполнить
+	Allowed bool
+	// RetryAfter - время до появления токена у отклоненного запроса
+	RetryAfter time.Duration
+	// Started - клиент превысил лимит только что, предыдущий его запрос был разрешен
+	Started bool
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limited bool
+}
+
+// Limiter выдает каждому клиенту rate токенов в секунду с запасом до burst.
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// New создает ограничитель. burst меньше 1 заменяется на rate, округленный вверх.
+func New(rate float64, burst int) *Limiter {
+	b := float64(burst)
+	if burst < 1 {
+		b = max(1, math.Ceil(rate))
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   b,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow списывает токен клиента key.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return Result{Allowed: true}
+	}
+
+	started := !b.limited
+	b.limited = true
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return Result{RetryAfter: wait, Started: started}
+}
+
+// prune удаляет корзины, которые успели заполниться: новая корзина для клиента будет такой же.
+func (l *Limiter) prune(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastPrune) < full {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
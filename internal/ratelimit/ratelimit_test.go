@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for range 3 {
+		require.True(t, l.Allow("agent-1").Allowed)
+	}
+
+	res := l.Allow("agent-1")
+	require.False(t, res.Allowed)
+	require.True(t, res.Started)
+	require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	// Повторный отказ не начинает новое превышение
+	res = l.Allow("agent-1")
+	require.False(t, res.Allowed)
+	require.False(t, res.Started)
+
+	// У другого клиента своя корзина
+	require.True(t, l.Allow("agent-2").Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	require.True(t, l.Allow("agent-1").Allowed)
+	require.False(t, l.Allow("agent-1").Allowed)
+
+	// Заполненные корзины удаляются
+	now = now.Add(time.Minute)
+	l.Allow("agent-3")
+	require.Len(t, l.buckets, 1)
+}
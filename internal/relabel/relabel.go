@@ -0,0 +1,238 @@
+// Package relabel фильтрует и переименовывает метрики по набору правил.
+package relabel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sync"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+)
+
+// Действия правил
+const (
+	// ActionKeep оставляет только подходящие метрики
+	ActionKeep = "keep"
+	// ActionDrop отбрасывает подходящие метрики
+	ActionDrop = "drop"
+	// ActionRename заменяет имя по Name, в Replacement доступны группы $1, ${name}
+	ActionRename = "rename"
+	// ActionPrefix добавляет Prefix к имени
+	ActionPrefix = "prefix"
+	// ActionGaugeToCounter превращает gauge с накопительным значением в приращение счетчика
+	ActionGaugeToCounter = "gauge_to_counter"
+)
+
+var (
+	ErrBadAction = errors.New("unknown relabel action")
+	ErrBadRule   = errors.New("bad relabel rule")
+)
+
+// Rule - одно правило. Пустые Name и Type подходят под любую метрику.
+type Rule struct {
+	Action      string `json:"action"`
+	Name        string `json:"name,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	name *regexp.Regexp
+}
+
+func (r compiledRule) match(m models.Metrics) bool {
+	if r.Type != "" && r.Type != m.MType {
+		return false
+	}
+	return r.name == nil || r.name.MatchString(m.ID)
+}
+
+// Pipeline применяет правила по порядку.
+// Правило gauge_to_counter хранит последние значения, поэтому Pipeline не копируется.
+type Pipeline struct {
+	rules []compiledRule
+
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// New проверяет правила и компилирует регулярные выражения.
+// Выражения привязываются к началу и концу имени.
+func New(rules []Rule) (*Pipeline, error) {
+	op := "relabel.New"
+
+	p := &Pipeline{last: make(map[string]float64)}
+
+	for i, rule := range rules {
+		switch rule.Action {
+		case ActionKeep, ActionDrop, ActionGaugeToCounter:
+		case ActionRename:
+			if rule.Name == "" {
+				return nil, fmt.Errorf("%s: rule %d: %w: rename requires name", op, i, ErrBadRule)
+			}
+		case ActionPrefix:
+			if rule.Prefix == "" {
+				return nil, fmt.Errorf("%s: rule %d: %w: prefix is empty", op, i, ErrBadRule)
+			}
+		default:
+			return nil, fmt.Errorf("%s: rule %d: %w %q", op, i, ErrBadAction, rule.Action)
+		}
+
+		if rule.Type != "" && rule.Type != models.Gauge && rule.Type != models.Counter {
+			return nil, fmt.Errorf("%s: rule %d: %w: unknown type %q", op, i, ErrBadRule, rule.Type)
+		}
+
+		compiled := compiledRule{Rule: rule}
+		if rule.Name != "" {
+			re, err := regexp.Compile("^(?:" + rule.Name + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%s: rule %d: %w", op, i, err)
+			}
+			compiled.name = re
+		}
+
+		p.rules = append(p.rules, compiled)
+	}
+
+	return p, nil
+}
+
+// Load читает правила из JSON-файла с массивом Rule.
+func Load(path string) (*Pipeline, error) {
+	op := "relabel.Load"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return New(rules)
+}
+
+// Baseline - базовые значения gauge_to_counter, от которых посчитаны приращения метрики.
+// Сохраняются в Pipeline через Commit, когда сервер принял метрику, иначе приращение было бы потеряно.
+type Baseline map[string]float64
+
+// Session применяет правила к метрикам одного отчета.
+// Базовые значения сдвигаются внутри сессии, чтобы несколько значений одного gauge давали приращения друг от друга,
+// а в Pipeline попадают только через Commit. Сессия не используется из нескольких горутин.
+type Session struct {
+	p    *Pipeline
+	last map[string]float64
+}
+
+// NewSession начинает сессию. Для nil Pipeline сессия пропускает метрики без изменений.
+func (p *Pipeline) NewSession() *Session {
+	return &Session{p: p, last: make(map[string]float64)}
+}
+
+// Apply возвращает метрику после применения правил и сразу сохраняет базовые значения gauge_to_counter.
+// Исходная метрика не изменяется.
+func (p *Pipeline) Apply(m models.Metrics) (models.Metrics, bool) {
+	m, baseline, ok := p.NewSession().Apply(m)
+	p.Commit(baseline)
+	return m, ok
+}
+
+// Commit сохраняет базовые значения принятой сервером метрики.
+func (p *Pipeline) Commit(baseline Baseline) {
+	if p == nil || len(baseline) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, value := range baseline {
+		p.last[id] = value
+	}
+}
+
+// Apply возвращает метрику после применения правил, ее базовые значения для Commit и false, если метрика отброшена.
+// Исходная метрика не изменяется.
+func (s *Session) Apply(m models.Metrics) (models.Metrics, Baseline, bool) {
+	if s.p == nil {
+		return m, nil, true
+	}
+
+	var baseline Baseline
+	for _, rule := range s.p.rules {
+		matched := rule.match(m)
+
+		switch rule.Action {
+		case ActionKeep:
+			if !matched {
+				return m, nil, false
+			}
+		case ActionDrop:
+			if matched {
+				return m, nil, false
+			}
+		case ActionRename:
+			if matched {
+				m.ID = rule.name.ReplaceAllString(m.ID, rule.Replacement)
+			}
+		case ActionPrefix:
+			if matched {
+				m.ID = rule.Prefix + m.ID
+			}
+		case ActionGaugeToCounter:
+			if matched && m.MType == models.Gauge {
+				id := m.ID
+				var ok bool
+				m, ok = s.toCounter(m)
+				if !ok {
+					return m, nil, false
+				}
+				if baseline == nil {
+					baseline = make(Baseline)
+				}
+				baseline[id] = s.last[id]
+			}
+		}
+	}
+
+	return m, baseline, true
+}
+
+// toCounter считает приращение gauge с прошлого значения в сессии или в Pipeline.
+// Первое значение передается целиком, уменьшение значения считается сбросом.
+// Нулевое приращение отбрасывается, сервер такие счетчики не принимает.
+func (s *Session) toCounter(m models.Metrics) (models.Metrics, bool) {
+	if m.Value == nil {
+		return m, false
+	}
+	current := *m.Value
+
+	prev, ok := s.last[m.ID]
+	if !ok {
+		s.p.mu.Lock()
+		prev, ok = s.p.last[m.ID]
+		s.p.mu.Unlock()
+	}
+
+	delta := current
+	if ok && current >= prev {
+		delta = current - prev
+	}
+
+	rounded := int64(math.Round(delta))
+	if rounded == 0 {
+		// Базовое значение не сдвигается, чтобы дробные приращения накапливались
+		return m, false
+	}
+	s.last[m.ID] = current - (delta - float64(rounded))
+
+	return models.Metrics{ID: m.ID, MType: models.Counter, Delta: &rounded}, true
+}
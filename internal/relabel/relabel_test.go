@@ -0,0 +1,130 @@
+package relabel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: lib.FloatPtr(v)}
+}
+
+func counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: lib.IntPtr(d)}
+}
+
+func TestPipeline_Apply(t *testing.T) {
+	p, err := New([]Rule{
+		{Action: ActionDrop, Name: "MCache.*|Lookups"},
+		{Action: ActionKeep, Name: "Heap.*|PollCount|NumGC"},
+		{Action: ActionRename, Name: "Heap(.*)", Replacement: "heap_$1"},
+		{Action: ActionPrefix, Type: models.Counter, Prefix: "host1."},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		in   models.Metrics
+		id   string
+		ok   bool
+	}{
+		{name: "drop", in: gauge("MCacheInuse", 1), ok: false},
+		{name: "not kept", in: gauge("Sys", 1), ok: false},
+		{name: "rename", in: gauge("HeapAlloc", 1), id: "heap_Alloc", ok: true},
+		{name: "prefix by type", in: counter("PollCount", 1), id: "host1.PollCount", ok: true},
+		{name: "kept as is", in: gauge("NumGC", 1), id: "NumGC", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, ok := p.Apply(tt.in)
+			require.Equal(t, tt.ok, ok)
+			if ok {
+				require.Equal(t, tt.id, out.ID)
+			}
+		})
+	}
+}
+
+func TestPipeline_GaugeToCounter(t *testing.T) {
+	p, err := New([]Rule{{Action: ActionGaugeToCounter, Name: "NumGC"}})
+	require.NoError(t, err)
+
+	out, ok := p.Apply(gauge("NumGC", 10))
+	require.True(t, ok)
+	require.Equal(t, models.Counter, out.MType)
+	require.Equal(t, int64(10), *out.Delta)
+
+	_, ok = p.Apply(gauge("NumGC", 10))
+	require.False(t, ok)
+
+	out, ok = p.Apply(gauge("NumGC", 14))
+	require.True(t, ok)
+	require.Equal(t, int64(4), *out.Delta)
+
+	// Сброс значения
+	out, ok = p.Apply(gauge("NumGC", 3))
+	require.True(t, ok)
+	require.Equal(t, int64(3), *out.Delta)
+
+	// Правило не трогает другие метрики
+	out, ok = p.Apply(gauge("Sys", 3))
+	require.True(t, ok)
+	require.Equal(t, models.Gauge, out.MType)
+}
+
+func TestSession_Commit(t *testing.T) {
+	p, err := New([]Rule{{Action: ActionGaugeToCounter, Name: "NumGC"}})
+	require.NoError(t, err)
+
+	// Внутри сессии значения дают приращения друг от друга
+	s := p.NewSession()
+	out, _, ok := s.Apply(gauge("NumGC", 10))
+	require.True(t, ok)
+	require.Equal(t, int64(10), *out.Delta)
+	out, baseline, ok := s.Apply(gauge("NumGC", 14))
+	require.True(t, ok)
+	require.Equal(t, int64(4), *out.Delta)
+
+	// Без Commit следующая сессия считает от прежнего базового значения
+	out, _, ok = p.NewSession().Apply(gauge("NumGC", 14))
+	require.True(t, ok)
+	require.Equal(t, int64(14), *out.Delta)
+
+	p.Commit(baseline)
+	_, _, ok = p.NewSession().Apply(gauge("NumGC", 14))
+	require.False(t, ok)
+}
+
+func TestNew_BadRules(t *testing.T) {
+	_, err := New([]Rule{{Action: "unknown"}})
+	require.ErrorIs(t, err, ErrBadAction)
+
+	_, err = New([]Rule{{Action: ActionRename}})
+	require.ErrorIs(t, err, ErrBadRule)
+
+	_, err = New([]Rule{{Action: ActionDrop, Type: "histogram"}})
+	require.ErrorIs(t, err, ErrBadRule)
+
+	_, err = New([]Rule{{Action: ActionDrop, Name: "("}})
+	require.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relabel.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"action":"drop","type":"gauge"}]`), 0644))
+
+	p, err := Load(path)
+	require.NoError(t, err)
+
+	_, ok := p.Apply(gauge("Sys", 1))
+	require.False(t, ok)
+
+	_, ok = p.Apply(counter("PollCount", 1))
+	require.True(t, ok)
+}
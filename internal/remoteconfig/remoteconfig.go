@@ -0,0 +1,159 @@
+// Package remoteconfig раздает агентам настройки с сервера.
+package remoteconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"go.uber.org/zap"
+)
+
+// Document - настройки агента. Незаданные поля агент берет из своих флагов.
+type Document struct {
+	PollInterval   *customtype.Time `json:"poll_interval,omitempty"`
+	ReportInterval *customtype.Time `json:"report_interval,omitempty"`
+	RateLimit      *int             `json:"rate_limit,omitempty"`
+	// Collectors - включенные сборщики, пустой список оставляет все
+	Collectors []string `json:"collectors,omitempty"`
+}
+
+// merge накладывает заданные поля other поверх d.
+func (d Document) merge(other Document) Document {
+	if other.PollInterval != nil {
+		d.PollInterval = other.PollInterval
+	}
+	if other.ReportInterval != nil {
+		d.ReportInterval = other.ReportInterval
+	}
+	if other.RateLimit != nil {
+		d.RateLimit = other.RateLimit
+	}
+	if other.Collectors != nil {
+		d.Collectors = other.Collectors
+	}
+	return d
+}
+
+// ETag возвращает версию документа.
+func (d Document) ETag() string {
+	data, _ := json.Marshal(d)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// File - содержимое файла настроек.
+// Настройки агента складываются из Default, затем группы агента, затем записи по его ID.
+type File struct {
+	Default Document            `json:"default"`
+	Groups  map[string]Document `json:"groups,omitempty"`
+	Agents  map[string]Document `json:"agents,omitempty"`
+}
+
+// Store хранит настройки из файла и перечитывает его при изменении.
+type Store struct {
+	path string
+	log  *zap.Logger
+
+	mu      sync.RWMutex
+	file    File
+	modTime time.Time
+	// changed закрывается и заменяется при каждом изменении настроек
+	changed chan struct{}
+}
+
+// New читает файл настроек.
+func New(path string, log *zap.Logger) (*Store, error) {
+	op := "remoteconfig.New"
+
+	s := &Store{path: path, log: log, changed: make(chan struct{})}
+	if _, err := s.reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return s, nil
+}
+
+// Resolve возвращает настройки агента с заданными ID и группой.
+func (s *Store) Resolve(id, group string) Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc := s.file.Default
+	if g, ok := s.file.Groups[group]; ok && group != "" {
+		doc = doc.merge(g)
+	}
+	if a, ok := s.file.Agents[id]; ok {
+		doc = doc.merge(a)
+	}
+	return doc
+}
+
+// Changed возвращает канал, который закроется при следующем изменении настроек.
+func (s *Store) Changed() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changed
+}
+
+// Watch проверяет время изменения файла до отмены ctx.
+// Ошибки чтения логируются, при этом остаются действовать прежние настройки.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			updated, err := s.reload()
+			if err != nil {
+				s.log.Error("Failed to reload agent config", zap.String("path", s.path), zap.Error(err))
+				continue
+			}
+			if updated {
+				s.log.Info("Agent config reloaded", zap.String("path", s.path))
+			}
+		}
+	}
+}
+
+// reload перечитывает файл, если он изменился.
+func (s *Store) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	same := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, err
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.file = file
+	s.modTime = info.ModTime()
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mu.Unlock()
+
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package remoteconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestStore_Resolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agents.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"default": {"poll_interval": "2s", "report_interval": "10s"},
+		"groups": {"web": {"report_interval": "30s", "collectors": ["runtime"]}},
+		"agents": {"a1": {"rate_limit": 3}}
+	}`), 0644))
+
+	store, err := New(path, zap.NewNop())
+	require.NoError(t, err)
+
+	doc := store.Resolve("a1", "web")
+	require.Equal(t, 2*time.Second, doc.PollInterval.Duration())
+	require.Equal(t, 30*time.Second, doc.ReportInterval.Duration())
+	require.Equal(t, 3, *doc.RateLimit)
+	require.Equal(t, []string{"runtime"}, doc.Collectors)
+
+	other := store.Resolve("b2", "")
+	require.Equal(t, 10*time.Second, other.ReportInterval.Duration())
+	require.Nil(t, other.RateLimit)
+	require.NotEqual(t, doc.ETag(), other.ETag())
+	require.Equal(t, other.ETag(), store.Resolve("c3", "unknown").ETag())
+}
+
+func TestStore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agents.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"default": {"rate_limit": 1}}`), 0644))
+
+	store, err := New(path, zap.NewNop())
+	require.NoError(t, err)
+
+	changed := store.Changed()
+	before := store.Resolve("a1", "").ETag()
+
+	updated, err := store.reload()
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"default": {"rate_limit": 2}}`), 0644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+
+	updated, err = store.reload()
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("changed channel is not closed after reload")
+	}
+	require.NotEqual(t, before, store.Resolve("a1", "").ETag())
+}
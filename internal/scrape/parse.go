@@ -0,0 +1,179 @@
+package scrape
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+)
+
+var ErrBadLine = errors.New("bad exposition line")
+
+// ParseJSON разбирает тело в формате /updates: массив []models.Metrics.
+func ParseJSON(r io.Reader) ([]models.Metrics, error) {
+	op := "scrape.ParseJSON"
+
+	var batch []models.Metrics
+	if err := json.NewDecoder(r).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result := batch[:0]
+	for _, m := range batch {
+		switch {
+		case m.ID == "":
+		case m.MType == models.Counter && m.Delta != nil:
+			result = append(result, m)
+		case m.MType == models.Gauge && m.Value != nil:
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
+// ParsePrometheus разбирает текстовый формат Prometheus.
+// Тип counter становится счетчиком, остальные типы - gauge.
+// Значения меток добавляются к имени через подчеркивание, NaN и бесконечности пропускаются.
+func ParsePrometheus(r io.Reader) ([]models.Metrics, error) {
+	op := "scrape.ParsePrometheus"
+
+	types := make(map[string]string)
+	var result []models.Metrics
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		name, labels, value, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", op, lineNum, err)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		id := name
+		for _, v := range labels {
+			id += "_" + v
+		}
+
+		if types[name] == models.Counter {
+			delta := int64(math.Round(value))
+			result = append(result, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+		} else {
+			result = append(result, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result, nil
+}
+
+// parseSample разбирает строку вида name{label="value",...} value [timestamp].
+func parseSample(line string) (string, []string, float64, error) {
+	var (
+		name   string
+		labels []string
+		rest   string
+	)
+
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		j := strings.LastIndexByte(line, '}')
+		if j < i {
+			return "", nil, 0, ErrBadLine
+		}
+		name = line[:i]
+
+		var err error
+		labels, err = parseLabels(line[i+1 : j])
+		if err != nil {
+			return "", nil, 0, err
+		}
+		rest = line[j+1:]
+	} else {
+		var ok bool
+		name, rest, ok = strings.Cut(line, " ")
+		if !ok {
+			return "", nil, 0, ErrBadLine
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if name == "" || len(fields) == 0 || len(fields) > 2 {
+		return "", nil, 0, ErrBadLine
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("%w: %w", ErrBadLine, err)
+	}
+
+	return name, labels, value, nil
+}
+
+// parseLabels возвращает значения меток в порядке их следования.
+func parseLabels(s string) ([]string, error) {
+	var values []string
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		_, after, ok := strings.Cut(s, "=")
+		if !ok || !strings.HasPrefix(after, `"`) {
+			return nil, ErrBadLine
+		}
+
+		value, tail, err := unquote(after)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		s = strings.TrimPrefix(strings.TrimSpace(tail), ",")
+	}
+
+	return values, nil
+}
+
+// unquote читает строку в кавычках с начала s и возвращает ее значение и остаток.
+func unquote(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", ErrBadLine
+			}
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", ErrBadLine
+}
@@ -0,0 +1,50 @@
+package scrape
+
+import (
+	"strings"
+	"testing"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrometheus(t *testing.T) {
+	body := `# HELP PollCount polls
+# TYPE PollCount counter
+PollCount 5
+# TYPE HeapAlloc gauge
+HeapAlloc 2.5 1700000000000
+http_requests{method="GET",code="200"} 7
+broken_value NaN
+`
+
+	metrics, err := ParsePrometheus(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+
+	require.Equal(t, "PollCount", metrics[0].ID)
+	require.Equal(t, models.Counter, metrics[0].MType)
+	require.Equal(t, int64(5), *metrics[0].Delta)
+
+	require.Equal(t, "HeapAlloc", metrics[1].ID)
+	require.Equal(t, 2.5, *metrics[1].Value)
+
+	require.Equal(t, "http_requests_GET_200", metrics[2].ID)
+	require.Equal(t, models.Gauge, metrics[2].MType)
+}
+
+func TestParsePrometheus_BadLine(t *testing.T) {
+	_, err := ParsePrometheus(strings.NewReader("no_value\n"))
+	require.ErrorIs(t, err, ErrBadLine)
+
+	_, err = ParsePrometheus(strings.NewReader(`m{a="b} 1` + "\n"))
+	require.ErrorIs(t, err, ErrBadLine)
+}
+
+func TestParseJSON(t *testing.T) {
+	body := `[{"id":"PollCount","type":"counter","delta":5},{"id":"HeapAlloc","type":"gauge","value":1.5},{"id":"","type":"gauge","value":1}]`
+
+	metrics, err := ParseJSON(strings.NewReader(body))
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+}
@@ -0,0 +1,303 @@
+// Package scrape опрашивает агенты, работающие в режиме pull, и передает их метрики в сервис.
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// Состояние цели
+const (
+	HealthUnknown = "unknown"
+	HealthUp      = "up"
+	HealthDown    = "down"
+)
+
+// Ingester принимает собранные метрики. Реализуется metrics.Service.
+type Ingester interface {
+	SetBatch(ctx context.Context, batch []models.Metrics, ip string) error
+}
+
+// Config - параметры опроса.
+type Config struct {
+	// Targets - адреса целей, путь по умолчанию /metrics
+	Targets []string
+	// Interval - период опроса каждой цели
+	Interval time.Duration
+	// Timeout - ограничение времени одного опроса
+	Timeout time.Duration
+	// Jitter - максимальная случайная задержка перед опросом, чтобы цели не опрашивались одновременно
+	Jitter time.Duration
+}
+
+// TargetStatus - состояние цели для GET /targets.
+type TargetStatus struct {
+	URL          string    `json:"url"`
+	Health       string    `json:"health"`
+	LastScrape   time.Time `json:"last_scrape,omitzero"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	Samples      int       `json:"samples"`
+}
+
+// Manager опрашивает цели с заданным интервалом.
+type Manager struct {
+	cfg     Config
+	ingest  Ingester
+	client  *http.Client
+	log     *zap.Logger
+	targets []*target
+}
+
+type target struct {
+	url    string
+	source string
+
+	mu     sync.Mutex
+	status TargetStatus
+	// counters - последние накопительные значения счетчиков цели
+	counters map[string]int64
+	// baseline - накопительные значения уже получены хотя бы одним принятым опросом
+	baseline bool
+}
+
+// New создает Manager. Цели с некорректным адресом приводят к ошибке.
+func New(cfg Config, ingest Ingester, log *zap.Logger) (*Manager, error) {
+	op := "scrape.New"
+
+	m := &Manager{
+		cfg:    cfg,
+		ingest: ingest,
+		client: &http.Client{},
+		log:    log,
+	}
+
+	for _, raw := range cfg.Targets {
+		t, err := newTarget(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		m.targets = append(m.targets, t)
+	}
+
+	return m, nil
+}
+
+func newTarget(raw string) (*target, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("target %q has no host", raw)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/metrics"
+	}
+
+	source := u.Host
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		source = host
+	}
+
+	return &target{
+		url:      u.String(),
+		source:   source,
+		status:   TargetStatus{URL: u.String(), Health: HealthUnknown},
+		counters: make(map[string]int64),
+	}, nil
+}
+
+// Run опрашивает цели до отмены ctx.
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range m.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.loop(ctx, t)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *Manager) loop(ctx context.Context, t *target) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if !m.sleepJitter(ctx) {
+			return
+		}
+
+		if err := m.scrape(ctx, t); err != nil {
+			m.log.Warn("Scrape failed", zap.String("target", t.url), zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) sleepJitter(ctx context.Context) bool {
+	if m.cfg.Jitter <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(rand.N(m.cfg.Jitter))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// scrape выполняет один опрос цели и обновляет ее состояние.
+func (m *Manager) scrape(ctx context.Context, t *target) error {
+	start := time.Now()
+
+	batch, err := m.fetch(ctx, t)
+	if err == nil {
+		var seen map[string]int64
+		batch, seen = t.deltas(batch)
+		if len(batch) > 0 {
+			err = m.ingest.SetBatch(ctx, batch, t.source)
+		}
+		// Если сервис не принял пакет, приращения будут повторены при следующем опросе
+		if err == nil {
+			t.commit(seen)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.LastScrape = start
+	t.status.LastDuration = time.Since(start).String()
+	t.status.Samples = len(batch)
+	if err != nil {
+		t.status.Health = HealthDown
+		t.status.LastError = err.Error()
+		return err
+	}
+
+	t.status.Health = HealthUp
+	t.status.LastError = ""
+	return nil
+}
+
+func (m *Manager) fetch(ctx context.Context, t *target) ([]models.Metrics, error) {
+	if m.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.cfg.Timeout)
+		defer cancel()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json, text/plain;q=0.9")
+
+	response, err := m.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("bad status: %s; body: %s", response.Status, string(body))
+	}
+
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") {
+		return ParseJSON(response.Body)
+	}
+	return ParsePrometheus(response.Body)
+}
+
+// deltas превращает накопительные значения счетчиков в приращения с прошлого опроса
+// и возвращает новые накопительные значения, которые сохраняются через commit.
+// Первый опрос цели служит точкой отсчета и приращений не дает: накопленное до него уже могло быть учтено,
+// например до перезапуска сервера. Счетчик, появившийся позже, и уменьшение значения,
+// которое означает перезапуск цели, передаются целиком.
+func (t *target) deltas(batch []models.Metrics) ([]models.Metrics, map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]int64)
+	result := make([]models.Metrics, 0, len(batch))
+	for _, m := range batch {
+		if m.MType != models.Counter {
+			result = append(result, m)
+			continue
+		}
+
+		current := *m.Delta
+		seen[m.ID] = current
+		if !t.baseline {
+			continue
+		}
+
+		delta := current
+		if prev, ok := t.counters[m.ID]; ok && current >= prev {
+			delta = current - prev
+		}
+
+		// Сервис не принимает нулевые приращения
+		if delta == 0 {
+			continue
+		}
+		result = append(result, models.Metrics{ID: m.ID, MType: models.Counter, Delta: &delta})
+	}
+
+	return result, seen
+}
+
+func (t *target) commit(seen map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, value := range seen {
+		t.counters[id] = value
+	}
+	t.baseline = true
+}
+
+// Status возвращает состояние всех целей, отсортированное по адресу.
+func (m *Manager) Status() []TargetStatus {
+	result := make([]TargetStatus, 0, len(m.targets))
+	for _, t := range m.targets {
+		t.mu.Lock()
+		result = append(result, t.status)
+		t.mu.Unlock()
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].URL < result[j].URL
+	})
+
+	return result
+}
@@ -0,0 +1,93 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeIngester struct {
+	batches [][]models.Metrics
+	ip      string
+}
+
+func (f *fakeIngester) SetBatch(_ context.Context, batch []models.Metrics, ip string) error {
+	f.batches = append(f.batches, batch)
+	f.ip = ip
+	return nil
+}
+
+func TestManager_Scrape(t *testing.T) {
+	var polls atomic.Int64
+	var path atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path.Store(r.URL.Path)
+		count := polls.Add(1) * 10
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]models.Metrics{
+			{ID: "PollCount", MType: models.Counter, Delta: &count},
+		})
+	}))
+	defer srv.Close()
+
+	ingester := &fakeIngester{}
+	manager, err := New(Config{Targets: []string{srv.URL}, Interval: time.Second, Timeout: time.Second}, ingester, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	target := manager.targets[0]
+	require.NoError(t, manager.scrape(ctx, target))
+	require.Equal(t, "/metrics", path.Load())
+	// Первый опрос только запоминает накопленные значения
+	require.Empty(t, ingester.batches)
+
+	require.NoError(t, manager.scrape(ctx, target))
+	require.NoError(t, manager.scrape(ctx, target))
+
+	require.Len(t, ingester.batches, 2)
+	require.Equal(t, int64(10), *ingester.batches[0][0].Delta)
+	require.Equal(t, int64(10), *ingester.batches[1][0].Delta)
+	require.Equal(t, "127.0.0.1", ingester.ip)
+
+	status := manager.Status()
+	require.Len(t, status, 1)
+	require.Equal(t, HealthUp, status[0].Health)
+
+	srv.Close()
+	require.Error(t, manager.scrape(ctx, target))
+	require.Equal(t, HealthDown, manager.Status()[0].Health)
+}
+
+func TestTarget_CounterReset(t *testing.T) {
+	target, err := newTarget("localhost:9101")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:9101/metrics", target.url)
+
+	value := func(v int64) []models.Metrics {
+		return []models.Metrics{{ID: "c", MType: models.Counter, Delta: &v}}
+	}
+
+	batch, seen := target.deltas(value(7))
+	target.commit(seen)
+	require.Empty(t, batch)
+
+	batch, seen = target.deltas(value(9))
+	target.commit(seen)
+	require.Equal(t, int64(2), *batch[0].Delta)
+
+	batch, seen = target.deltas(value(9))
+	target.commit(seen)
+	require.Empty(t, batch)
+
+	// Значение уменьшилось - агент перезапущен
+	batch, _ = target.deltas(value(3))
+	require.Equal(t, int64(3), *batch[0].Delta)
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/s0n1cAK/yandex-metrics/internal/audit"
+	"github.com/s0n1cAK/yandex-metrics/internal/config/db"
+	"github.com/s0n1cAK/yandex-metrics/internal/config/server"
+	"github.com/s0n1cAK/yandex-metrics/internal/scrape"
+	dbstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/dbStorage"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+	"go.uber.org/zap"
+)
+
+// adminPingTimeout ограничивает проверку базы данных в /health служебного сервера
+const adminPingTimeout = 2 * time.Second
+
+// Состояние сервера в /health
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+)
+
+// health - подробное состояние сервера для служебного /health.
+type health struct {
+	Status     string `json:"status"`
+	Uptime     string `json:"uptime"`
+	Goroutines int    `json:"goroutines"`
+	// Storage - ok или ошибка проверки базы данных, memory для хранилища в памяти
+	Storage      string `json:"storage"`
+	Agents       int    `json:"agents"`
+	SilentAgents int    `json:"silent_agents"`
+	Targets      int    `json:"targets"`
+	TargetsDown  int    `json:"targets_down"`
+	// Audit - очереди и ошибки приемников аудита
+	Audit []audit.ObserverStats `json:"audit"`
+}
+
+// adminRouter создает обработчик служебного сервера: pprof, expvar, уровень логов, настройки без секретов
+// и подробное состояние. При включенных токенах доступа все пути требуют области admin.
+func (c *Server) adminRouter(store tokens.Store) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	if store != nil {
+		r.Use(authenticate(store, nil, func(*http.Request) tokens.Scope { return tokens.ScopeAdmin }, c.Config.Logger))
+	}
+
+	r.HandleFunc("/debug/pprof/*", pprof.Index)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.Handle("/debug/vars", expvar.Handler())
+
+	// Уровень меняется запросом PUT с {"level":"debug"}
+	if c.Config.LogLevel != nil {
+		r.Handle("/log/level", c.Config.LogLevel)
+	}
+
+	r.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, server.Redact(*c.Config))
+	})
+
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		h := c.health(r.Context())
+		status := http.StatusOK
+		if h.Status != healthOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, h)
+	})
+
+	return r
+}
+
+func (c *Server) health(ctx context.Context) health {
+	h := health{
+		Status:     healthOK,
+		Uptime:     time.Since(c.started).Truncate(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Storage:    "memory",
+		Audit:      c.audit.Stats(),
+	}
+
+	if _, ok := c.Storage.(*dbstorage.PostgresStorage); ok {
+		ctx, cancel := context.WithTimeout(ctx, adminPingTimeout)
+		defer cancel()
+
+		h.Storage = healthOK
+		if err := db.NewPinger(c.Config.DSN).Ping(ctx); err != nil {
+			h.Storage = err.Error()
+			h.Status = healthDegraded
+		}
+	}
+
+	for _, agent := range c.inventory.List() {
+		h.Agents++
+		if agent.Silent {
+			h.SilentAgents++
+		}
+	}
+	for _, target := range c.scraper.Status() {
+		h.Targets++
+		if target.Health == scrape.HealthDown {
+			h.TargetsDown++
+		}
+	}
+	return h
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// startAdmin запускает служебный сервер, nil если он отключен.
+// Сокет unix доступен только владельцу процесса, это и есть его проверка доступа.
+func (c *Server) startAdmin() (*http.Server, error) {
+	network, address, err := server.AdminListener(*c.Config)
+	if err != nil || network == "" {
+		return nil, err
+	}
+
+	if network == "unix" {
+		// Сокет мог остаться после аварийного завершения
+		if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := os.Chmod(address, 0o600); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	srv := &http.Server{
+		Handler:           c.admin,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.Config.Logger.Error("Ошибка служебного сервера", zap.Error(err))
+		}
+	}()
+
+	c.Config.Logger.Info("Служебный сервер запущен", zap.String("network", network), zap.String("address", address))
+	return srv, nil
+}
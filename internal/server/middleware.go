@@ -4,14 +4,29 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/s0n1cAK/yandex-metrics/internal/audit"
+	"github.com/s0n1cAK/yandex-metrics/internal/encryption"
 	"github.com/s0n1cAK/yandex-metrics/internal/hash"
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
+	"github.com/s0n1cAK/yandex-metrics/internal/inventory"
 	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/ratelimit"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
 	filestorage "github.com/s0n1cAK/yandex-metrics/internal/storage/fileStorage"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
 	"go.uber.org/zap"
 )
 
@@ -188,6 +203,7 @@ func writeMetrics(p *filestorage.Producer) func(http.Handler) http.Handler {
 				// Now read from the buffer to get the request body for metrics production
 				var metric models.Metrics
 				if err := json.Unmarshal(buf.Bytes(), &metric); err == nil {
+					metric.Tenant = tenant.FromContext(r.Context())
 					if err := p.WriteMetric(metric); err != nil {
 						w.WriteHeader(http.StatusInternalServerError)
 						return
@@ -234,3 +250,415 @@ func checkHash(key string) func(http.Handler) http.Handler {
 		return http.HandlerFunc(hash)
 	}
 }
+
+// decryptBody расшифровывает тело запроса с заголовком encryption.HeaderScheme.
+// Работает до распаковки gzip и проверки подписи: они получают исходное тело агента.
+// Без ключа сервера зашифрованные запросы отклоняются, незашифрованные проходят без изменений,
+// а при required незашифрованные изменяющие запросы отклоняются.
+func decryptBody(d *encryption.Decrypter, required bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(encryption.HeaderScheme)
+			if scheme == "" {
+				if required && mutating(r.Method) {
+					http.Error(w, "encryption is required", http.StatusBadRequest)
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+			if d == nil {
+				http.Error(w, "encrypted requests are not accepted", http.StatusBadRequest)
+				return
+			}
+
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "unable to read body", http.StatusBadRequest)
+				return
+			}
+
+			plain, err := d.Decrypt(scheme, data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(plain))
+			r.ContentLength = int64(len(plain))
+			r.Header.Del(encryption.HeaderScheme)
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkSignature проверяет подпись HMAC запроса.
+// Если legacyKey не пуст, запрос без подписи HMAC может быть подписан заголовком HashSHA256.
+func checkSignature(v *signing.Verifier, legacyKey string) func(http.Handler) http.Handler {
+	legacy := checkHash(legacyKey)
+
+	return func(h http.Handler) http.Handler {
+		legacyHash := legacy(h)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !signing.Signed(r.Header) {
+				if legacyKey != "" && r.Header.Get("HashSHA256") != "" {
+					legacyHash.ServeHTTP(w, r)
+					return
+				}
+				http.Error(w, signing.ErrUnsigned.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "unable to read body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if err := v.Verify(r.Header, r.Method, r.URL.Path, body); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// signaturePolicy требует подпись у запросов на запись (isWrite) и подписывает тела всех ответов.
+// verify проверяет подпись запроса, nil пропускает запросы без проверки.
+// Записи на пути из exempt не проверяются.
+func signaturePolicy(verify, sign func(http.Handler) http.Handler, exempt []string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		signed := h
+		if sign != nil {
+			signed = sign(h)
+		}
+		// Подпись ответа заменяет HashSHA256 запроса, который checkHash возвращает в ответе
+		verified := signed
+		if verify != nil {
+			verified = verify(signed)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWrite(r) && !exempted(r.URL.Path, exempt) {
+				verified.ServeHTTP(w, r)
+				return
+			}
+			signed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// exempted сообщает, совпадает ли path с одним из exempt или вложен в него: /update исключает и /update/gauge/x/1.
+func exempted(path string, exempt []string) bool {
+	path = strings.TrimRight(path, "/")
+	return slices.ContainsFunc(exempt, func(e string) bool {
+		e = strings.TrimRight(e, "/")
+		return path == e || strings.HasPrefix(path, e+"/")
+	})
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// readRoutes перечисляет пути, которые принимают POST, но только читают метрики.
+var readRoutes = []string{"/value"}
+
+// isWrite сообщает, изменяет ли запрос данные: изменяющий метод на любом пути, кроме readRoutes.
+func isWrite(r *http.Request) bool {
+	return mutating(r.Method) && !exempted(r.URL.Path, readRoutes)
+}
+
+// bufferedResponseWriter накапливает ответ, чтобы подписать его перед отправкой.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// signResponses подписывает тело ответа до сжатия: HMAC ключом signer и HashSHA256 ключом legacyKey.
+func signResponses(signer signing.Signer, legacyKey string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := &bufferedResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(bw, r)
+
+			body := bw.body.Bytes()
+			if signer.Enabled() {
+				signer.Sign(w.Header(), r.Method, r.URL.Path, body)
+			}
+			if legacyKey != "" {
+				w.Header().Set("HashSHA256", hash.GetHashHex(bytes.Clone(body), legacyKey))
+			}
+
+			if bw.status != 0 {
+				w.WriteHeader(bw.status)
+			}
+			w.Write(body)
+		})
+	}
+}
+
+// trustedSubnet пропускает изменяющие запросы только с X-Real-IP из trusted, чтение не ограничивается.
+// Работает до middleware.RealIP и удаляет True-Client-IP и X-Forwarded-For: иначе RealIP мог бы
+// подставить в RemoteAddr адрес из них, и в аудит попал бы не тот адрес, что был проверен.
+func trustedSubnet(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del("True-Client-IP")
+			r.Header.Del("X-Forwarded-For")
+
+			if !isWrite(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ip, err := netip.ParseAddr(r.Header.Get("X-Real-IP"))
+			if err != nil || !slices.ContainsFunc(trusted, func(p netip.Prefix) bool { return p.Contains(ip.Unmap()) }) {
+				http.Error(w, "address is not in trusted subnet", http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticate пропускает запросы только с действующим токеном Authorization: Bearer, у которого есть
+// область, нужная по scope. Без токена или с неизвестным токеном отвечает 401, без нужной области - 403.
+// Пути из open доступны без токена.
+func authenticate(store tokens.Store, open []string, scope func(*http.Request) tokens.Scope, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempted(r.URL.Path, open) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := tokens.Authenticate(r.Context(), store, tokens.FromHeader(r.Header))
+			switch {
+			case errors.Is(err, tokens.ErrNoToken), errors.Is(err, tokens.ErrBadToken), errors.Is(err, tokens.ErrRevoked):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			case err != nil:
+				log.Error("Failed to check token", zap.Error(err))
+				http.Error(w, "failed to check token", http.StatusInternalServerError)
+				return
+			}
+
+			required := scope(r)
+			if !token.Allows(required) {
+				http.Error(w, fmt.Sprintf("token has no %q scope", required), http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(tokens.WithContext(r.Context(), token)))
+		})
+	}
+}
+
+// resolveTenant определяет арендатора запроса и сохраняет его в контексте.
+// Арендатор токена действует всегда, заголовок tenant.Header с другим значением отклоняется.
+// Выбрать арендатора заголовком может токен admin без арендатора, а при выключенной проверке токенов - любой клиент,
+// но только из known: иначе каждое новое имя получало бы свою квоту.
+// Остальные токены без арендатора работают с арендатором по умолчанию.
+func resolveTenant(authEnabled bool, known map[string]tenant.Settings) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested := r.Header.Get(tenant.Header)
+			if err := tenant.Validate(requested); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			name := requested
+			if token, ok := tokens.FromContext(r.Context()); ok {
+				switch {
+				case token.Tenant != tenant.Default:
+					name = token.Tenant
+				case !token.Allows(tokens.ScopeAdmin):
+					name = tenant.Default
+				}
+			} else if authEnabled {
+				// Запрос на открытый путь без токена
+				name = tenant.Default
+			} else if _, ok := known[name]; !ok && name != tenant.Default {
+				http.Error(w, tenant.ErrUnknown.Error(), http.StatusForbidden)
+				return
+			}
+
+			if requested != "" && requested != name {
+				http.Error(w, tenant.ErrMismatch.Error(), http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(tenant.WithContext(r.Context(), name)))
+		})
+	}
+}
+
+// perTenant применяет к запросу middleware его арендатора из byTenant,
+// к запросам остальных арендаторов - fallback.
+func perTenant(byTenant map[string]func(http.Handler) http.Handler, fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		handlers := make(map[string]http.Handler, len(byTenant))
+		for name, mw := range byTenant {
+			handlers[name] = mw(h)
+		}
+		def := fallback(h)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if handler, ok := handlers[tenant.FromContext(r.Context())]; ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			def.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requiredScope возвращает область токена для запроса: admin для удаления и /admin,
+// write для остальных изменяющих запросов, кроме POST /value, read для чтения.
+func requiredScope(r *http.Request) tokens.Scope {
+	switch {
+	case r.Method == http.MethodDelete || exempted(r.URL.Path, []string{"/admin"}):
+		return tokens.ScopeAdmin
+	case isWrite(r):
+		return tokens.ScopeWrite
+	}
+	return tokens.ScopeRead
+}
+
+// clientCertificate передает в контекст запроса имя из проверенного сертификата клиента mTLS.
+func clientCertificate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.PeerCertificates[0]
+		name := cert.Subject.CommonName
+		if name == "" && len(cert.DNSNames) > 0 {
+			name = cert.DNSNames[0]
+		}
+
+		h.ServeHTTP(w, r.WithContext(identity.WithPeer(r.Context(), name)))
+	})
+}
+
+// trackAgents передает идентичность агента в контекст запроса и учитывает его в реестре.
+// Запросы без X-Agent-ID пропускаются без изменений.
+func trackAgents(inv *inventory.Inventory) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := identity.FromHeaders(r.Header)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ww := &statusCodeCaptureWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			h.ServeHTTP(ww, r.WithContext(identity.WithContext(r.Context(), id)))
+
+			if r.Method == http.MethodGet {
+				inv.Touch(id, r.RemoteAddr)
+				return
+			}
+			inv.Observe(id, r.RemoteAddr, ww.statusCode >= http.StatusBadRequest)
+		})
+	}
+}
+
+// EventRateLimited - событие аудита о клиенте, превысившем ограничение частоты запросов
+const EventRateLimited = "rate_limited"
+
+// socketAddr сохраняет в контексте адрес соединения. Работает до middleware.RealIP,
+// который заменяет RemoteAddr адресом из заголовков клиента.
+func socketAddr(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(identity.WithSocketAddr(r.Context(), r.RemoteAddr)))
+	})
+}
+
+// identifyClient сохраняет в контексте ключ клиента для ограничений частоты запросов и числа метрик:
+// токен доступа, иначе имя из сертификата mTLS, иначе адрес соединения.
+// Адрес из X-Real-IP и X-Forwarded-For не используется: клиент выбирает его сам и обходил бы ограничения.
+func identifyClient(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var key string
+		if token, ok := tokens.FromContext(r.Context()); ok {
+			key = "token:" + token.ID
+		} else if peer, ok := identity.PeerFromContext(r.Context()); ok {
+			key = "cert:" + peer
+		} else {
+			addr, ok := identity.SocketAddrFromContext(r.Context())
+			if !ok {
+				addr = r.RemoteAddr
+			}
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			key = "ip:" + host
+		}
+
+		h.ServeHTTP(w, r.WithContext(identity.WithClient(r.Context(), key)))
+	})
+}
+
+// rateLimit ограничивает частоту изменяющих запросов каждого клиента, чтение не ограничивается.
+// Лишние запросы получают 429 с Retry-After, о начале превышения сообщается в аудит.
+func rateLimit(limiter *ratelimit.Limiter, publisher *audit.AuditPublisher, log *zap.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isWrite(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			client := identity.ClientFromContext(r.Context())
+			res := limiter.Allow(client)
+			if res.Allowed {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if res.Started {
+				event := audit.NewEvent(r.Context(), r.RemoteAddr)
+				event.Event = EventRateLimited
+				event.Reason = "client " + client + " exceeded request rate"
+				if err := publisher.Publish(event); err != nil {
+					log.Error("Failed to publish audit event", zap.Error(err))
+				}
+			}
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+			http.Error(w, "too many requests, retry later", http.StatusTooManyRequests)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	agentconfig "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/config/server"
+	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"github.com/s0n1cAK/yandex-metrics/internal/encryption"
+	"github.com/s0n1cAK/yandex-metrics/internal/hash"
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/service/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
+	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCheckSignature(t *testing.T) {
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	signer := signing.Signer{KeyID: "v1", Key: "secret"}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(h http.Handler, header http.Header) int {
+		req := httptest.NewRequest(http.MethodPost, "/updates", bytes.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("signed and replayed", func(t *testing.T) {
+		h := checkSignature(signing.NewVerifier(signing.Keyring{"v1": "secret"}, time.Minute), "")(ok)
+
+		header := http.Header{}
+		signer.Sign(header, http.MethodPost, "/updates", body)
+
+		require.Equal(t, http.StatusOK, serve(h, header))
+		require.Equal(t, http.StatusUnauthorized, serve(h, header))
+	})
+
+	t.Run("legacy hash is opt-in", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("HashSHA256", hash.GetHashHex(body, "legacy"))
+
+		strict := checkSignature(signing.NewVerifier(signing.Keyring{"v1": "secret"}, time.Minute), "")(ok)
+		require.Equal(t, http.StatusUnauthorized, serve(strict, header))
+
+		compat := checkSignature(signing.NewVerifier(signing.Keyring{"v1": "secret"}, time.Minute), "legacy")(ok)
+		require.Equal(t, http.StatusOK, serve(compat, header))
+	})
+}
+
+func TestSignaturePolicy(t *testing.T) {
+	keys := signing.Keyring{"v1": "secret"}
+	signer := signing.Signer{KeyID: "v1", Key: "secret"}
+
+	cfg := &server.Config{
+		Endpoint:   customtype.Endpoint("http://localhost:8080"),
+		Logger:     zap.NewNop(),
+		File:       filepath.Join(t.TempDir(), "metrics.data"),
+		SignKeys:   keys,
+		SignSkew:   customtype.Time(time.Minute),
+		SignExempt: []string{"/update/counter"},
+	}
+	srv, err := New(cfg, memstorage.New())
+	require.NoError(t, err)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// URL-обновление без подписи отклоняется, как и пакетное
+	w := serve(httptest.NewRequest(http.MethodPost, "/update/gauge/cpu/1", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/cpu/1", nil)
+	signer.Sign(req.Header, req.Method, req.URL.Path, nil)
+	w = serve(req)
+	require.Equal(t, http.StatusOK, w.Code)
+	// Ответ на изменяющий запрос тоже подписан по его телу
+	require.NoError(t, signing.Check(keys, w.Header(), http.MethodPost, "/update/gauge/cpu/1", w.Body.Bytes()))
+
+	// Путь из списка исключений принимается без подписи
+	w = serve(httptest.NewRequest(http.MethodPost, "/update/counter/requests/1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Ответ на чтение подписан и проверяется ключом клиента
+	w = serve(httptest.NewRequest(http.MethodGet, "/value/gauge/cpu", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "1", w.Body.String())
+	require.NoError(t, signing.Check(keys, w.Header(), http.MethodGet, "/value/gauge/cpu", w.Body.Bytes()))
+
+	// POST /value остается чтением при любом списке исключений
+	req = httptest.NewRequest(http.MethodPost, "/value", strings.NewReader(`{"id":"cpu","type":"gauge"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = serve(req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, signing.Check(keys, w.Header(), http.MethodPost, "/value", w.Body.Bytes()))
+}
+
+func TestDecryptBody(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	privPath := filepath.Join(dir, "server.key")
+	pubPath := filepath.Join(dir, "server.pub")
+	require.NoError(t, os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600))
+	require.NoError(t, os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644))
+
+	storage := memstorage.New()
+	srv, err := New(&server.Config{
+		Endpoint:  customtype.Endpoint("http://localhost:8080"),
+		Logger:    zap.NewNop(),
+		File:      filepath.Join(dir, "metrics.data"),
+		CryptoKey: privPath,
+		// Агент с открытым ключом проходит и при обязательном шифровании
+		RequireEncryption: true,
+	}, storage)
+	require.NoError(t, err)
+
+	var encrypted atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encrypted.Store(r.Header.Get(encryption.HeaderScheme) == encryption.SchemeRSA)
+		srv.Router.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	cfg := agentconfig.Default(zap.NewNop())
+	require.NoError(t, cfg.Endpoints.Set(ts.URL))
+	cfg.AgentIDFile = ""
+	cfg.CryptoKey = pubPath
+
+	metricsAgent, err := agent.NewFromConfig(cfg, memstorage.New())
+	require.NoError(t, err)
+	require.NoError(t, metricsAgent.Storage.Set("PollCount", models.Metrics{ID: "PollCount", MType: models.Counter, Delta: lib.IntPtr(3)}))
+	require.NoError(t, metricsAgent.Report(context.Background()))
+
+	require.True(t, encrypted.Load())
+	stored, ok := storage.Get("PollCount")
+	require.True(t, ok)
+	require.Equal(t, int64(3), *stored.Delta)
+
+	// Незашифрованная запись отклоняется, чтение доступно
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/1", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/value/counter/PollCount", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTrustedSubnet(t *testing.T) {
+	cfg := &server.Config{
+		Endpoint:      customtype.Endpoint("http://localhost:8080"),
+		Logger:        zap.NewNop(),
+		File:          filepath.Join(t.TempDir(), "metrics.data"),
+		TrustedSubnet: []string{"10.0.0.0/8", "192.168.1.0/24"},
+	}
+	srv, err := New(cfg, memstorage.New())
+	require.NoError(t, err)
+
+	write := func(realIP, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/update/gauge/cpu/1", nil)
+		if realIP != "" {
+			req.Header.Set("X-Real-IP", realIP)
+		}
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, write("10.1.2.3", ""))
+	require.Equal(t, http.StatusOK, write("192.168.1.7", ""))
+	require.Equal(t, http.StatusForbidden, write("192.168.2.7", ""))
+	require.Equal(t, http.StatusForbidden, write("", ""))
+	// Адрес из X-Forwarded-For не заменяет X-Real-IP
+	require.Equal(t, http.StatusForbidden, write("", "10.1.2.3"))
+
+	// Чтение доступно из любой сети, в том числе JSON-чтение через POST /value
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/value/gauge/cpu", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/value", strings.NewReader(`{"id":"cpu","type":"gauge"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Real-IP", "192.168.2.7")
+	w = httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthenticate(t *testing.T) {
+	dir := t.TempDir()
+	store := tokens.NewFileStore(filepath.Join(dir, "tokens.json"))
+
+	create := func(name string, scopes ...tokens.Scope) string {
+		value, token, err := tokens.Generate(name, scopes)
+		require.NoError(t, err)
+		require.NoError(t, store.Create(context.Background(), token))
+		return value
+	}
+	writer := create("agent", tokens.ScopeWrite)
+	reader := create("grafana", tokens.ScopeRead)
+	admin := create("ops", tokens.ScopeAdmin)
+
+	cfg := &server.Config{
+		Endpoint:   customtype.Endpoint("http://localhost:8080"),
+		Logger:     zap.NewNop(),
+		File:       filepath.Join(dir, "metrics.data"),
+		AuditFile:  filepath.Join(dir, "audit.log"),
+		TokenStore: filepath.Join(dir, "tokens.json"),
+	}
+	srv, err := New(cfg, memstorage.New())
+	require.NoError(t, err)
+
+	serve := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		tokens.SetHeader(req.Header, token)
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/update/gauge/cpu/1", ""))
+	require.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/update/gauge/cpu/1", "bogus"))
+	require.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/update/gauge/cpu/1", reader))
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/cpu/1", writer))
+
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/value/gauge/cpu", writer))
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/value/gauge/cpu", reader))
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/", admin))
+
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/admin/metrics", reader))
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/admin/metrics", admin))
+
+	// pprof доступен только на служебном сервере
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/debug/pprof/", admin))
+
+	// Проверка доступности не требует токена
+	require.NotEqual(t, http.StatusUnauthorized, serve(http.MethodGet, "/ping", ""))
+
+	// Аудит записи содержит токен, с которым она выполнена
+	// Аудит пишется в фоне, Close дожидается записи
+	require.NoError(t, srv.audit.Close(context.Background()))
+	audit, err := os.ReadFile(cfg.AuditFile)
+	require.NoError(t, err)
+	require.Contains(t, string(audit), `"token_name":"agent"`)
+}
@@ -2,22 +2,33 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
-	_ "net/http/pprof"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/s0n1cAK/yandex-metrics/internal/audit"
+	"github.com/s0n1cAK/yandex-metrics/internal/certs"
 	"github.com/s0n1cAK/yandex-metrics/internal/config/db"
 	"github.com/s0n1cAK/yandex-metrics/internal/config/server"
+	"github.com/s0n1cAK/yandex-metrics/internal/encryption"
+	"github.com/s0n1cAK/yandex-metrics/internal/inventory"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/ratelimit"
+	"github.com/s0n1cAK/yandex-metrics/internal/remoteconfig"
+	"github.com/s0n1cAK/yandex-metrics/internal/scrape"
 	"github.com/s0n1cAK/yandex-metrics/internal/service/metrics"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
 	"github.com/s0n1cAK/yandex-metrics/internal/storage"
 	dbstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/dbStorage"
 	filestorage "github.com/s0n1cAK/yandex-metrics/internal/storage/fileStorage"
 	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
 	"github.com/s0n1cAK/yandex-metrics/internal/transport/httpx"
 	"go.uber.org/zap"
 )
@@ -25,6 +36,13 @@ import (
 const (
 	minPort = 0
 	maxPort = 65535
+
+	// agentConfigReload - период проверки изменений файла настроек агентов
+	agentConfigReload = 5 * time.Second
+	// certReload - период проверки изменений сертификата сервера
+	certReload = 10 * time.Second
+	// tokenStoreTimeout ограничивает подключение к хранилищу токенов при создании сервера
+	tokenStoreTimeout = 10 * time.Second
 )
 
 // Server представляет HTTP-сервер для сервиса метрик.
@@ -43,6 +61,24 @@ type Server struct {
 	consumer *filestorage.Consumer
 	// producer используется для записи метрик в файловое хранилище
 	producer *filestorage.Producer
+	// scraper опрашивает агентов, работающих в режиме pull
+	scraper *scrape.Manager
+	// inventory - реестр агентов, отправлявших метрики
+	inventory *inventory.Inventory
+	// agentConfig - настройки агентов, nil если файл настроек не задан
+	agentConfig *remoteconfig.Store
+	// certs перечитывает сертификат сервера, nil без TLS
+	certs *certs.Reloader
+	// tlsConfig - настройки TLS, nil если сервер работает по HTTP
+	tlsConfig *tls.Config
+	// tokens - хранилище токенов доступа, nil если проверка токенов отключена
+	tokens tokens.Store
+	// audit рассылает события аудита, закрывается после остановки HTTP-сервера
+	audit *audit.AuditPublisher
+	// admin - обработчик служебного сервера, nil если он отключен
+	admin http.Handler
+	// started - время запуска для /health служебного сервера
+	started time.Time
 }
 
 // New создает новый экземпляр Server с заданной конфигурацией и хранилищем.
@@ -53,17 +89,55 @@ func New(cfg *server.Config, storage storage.BasicStorage) (*Server, error) {
 	var producer *filestorage.Producer
 	var err error
 
-	publisher := audit.AuditPublisher{}
+	op := "Server.New"
+
+	publisher, err := audit.NewPublisher(server.AuditOptions(*cfg), cfg.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
+	// Приемники одного файла общие, чтобы записи в него шли под одной блокировкой
+	files := make(map[string]*audit.FileAuditObserver)
+	fileObserver := func(path string) *audit.FileAuditObserver {
+		if _, ok := files[path]; !ok {
+			files[path] = audit.NewFileAuditObserver(path)
+		}
+		return files[path]
+	}
 
+	var observers []audit.AuditObserver
 	if cfg.AuditFile != "" {
-		publisher.Register(audit.NewFileAuditObserver(cfg.AuditFile))
+		observers = append(observers, fileObserver(cfg.AuditFile))
 	}
 
 	if cfg.AuditURL != "" {
-		publisher.Register(audit.NewHTTPAuditObserver(cfg.AuditURL))
+		observers = append(observers, audit.NewHTTPAuditObserver(cfg.AuditURL))
 	}
 
-	op := "Server.New"
+	var tenants map[string]tenant.Settings
+	if cfg.TenantsFile != "" {
+		tenants, err = tenant.Load(cfg.TenantsFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		cfg.Logger.Info("Загружены настройки арендаторов", zap.Int("tenants", len(tenants)))
+	}
+
+	// Арендатор получает свои события в дополнение к общим приемникам
+	for name, ts := range tenants {
+		if ts.AuditFile != "" {
+			observers = append(observers, audit.NewTenantAuditObserver(name, fileObserver(ts.AuditFile)))
+		}
+		if ts.AuditURL != "" {
+			observers = append(observers, audit.NewTenantAuditObserver(name, audit.NewHTTPAuditObserver(ts.AuditURL)))
+		}
+	}
+
+	for _, o := range observers {
+		if err := publisher.Register(o); err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+	}
 
 	domain, port, err := parseURL(cfg)
 	if err != nil {
@@ -80,39 +154,127 @@ func New(cfg *server.Config, storage storage.BasicStorage) (*Server, error) {
 		return nil, fmt.Errorf("%s: %s", op, err)
 	}
 
+	agents := inventory.New(cfg.AgentSilence.Duration(), publisher, cfg.Logger)
+
+	var (
+		reloader  *certs.Reloader
+		tlsConfig *tls.Config
+	)
+	if cfg.TLSCert != "" {
+		reloader, err = certs.NewReloader(cfg.TLSCert, cfg.TLSKey, cfg.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		tlsConfig, err = certs.ServerConfig(reloader, cfg.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+	} else if cfg.TLSClientCA != "" {
+		return nil, fmt.Errorf("%s: %s", op, server.ErrBadTLS)
+	}
+
+	var decrypter *encryption.Decrypter
+	if cfg.CryptoKey != "" {
+		decrypter, err = encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		cfg.Logger.Info("Включена расшифровка запросов агентов", zap.Bool("required", cfg.RequireEncryption))
+	}
+
+	trusted, err := server.ParseSubnets(cfg.TrustedSubnet)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
+	if cfg.ClientRateLimit < 0 || cfg.ClientRateBurst < 0 || cfg.MaxMetrics < 0 || cfg.MaxClientMetrics < 0 {
+		return nil, fmt.Errorf("%s: %s", op, server.ErrBadLimits)
+	}
+
+	if _, _, err := server.AdminListener(*cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tokenStoreTimeout)
+	defer cancel()
+
+	tokenStore, err := tokens.Open(ctx, cfg.TokenStore, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
 	r := chi.NewRouter()
+	r.Use(socketAddr)
+	if len(trusted) > 0 {
+		cfg.Logger.Info("Запись метрик разрешена только из доверенных сетей", zap.Strings("subnets", cfg.TrustedSubnet))
+		r.Use(trustedSubnet(trusted))
+	}
 	r.Use(middleware.RealIP)
+	r.Use(clientCertificate)
 	r.Use(middleware.Recoverer)
 	r.Use(Logging(cfg.Logger))
+	if tokenStore != nil {
+		cfg.Logger.Info("Включена проверка токенов доступа", zap.String("store", cfg.TokenStore))
+		// /ping нужен агентам и балансировщикам для проверки доступности и ничего не раскрывает
+		r.Use(authenticate(tokenStore, []string{"/ping"}, requiredScope, cfg.Logger))
+	}
+	r.Use(resolveTenant(tokenStore != nil, tenants))
+	r.Use(identifyClient)
+	if cfg.ClientRateLimit > 0 {
+		cfg.Logger.Info("Включено ограничение частоты запросов клиентов",
+			zap.Float64("rate", cfg.ClientRateLimit),
+			zap.Int("burst", cfg.ClientRateBurst),
+		)
+		// Лишние запросы отклоняются до расшифровки и распаковки тела
+		r.Use(rateLimit(ratelimit.New(cfg.ClientRateLimit, cfg.ClientRateBurst), publisher, cfg.Logger))
+	}
+	r.Use(trackAgents(agents))
+	r.Use(decryptBody(decrypter, cfg.RequireEncryption))
 	r.Use(gzipCompession())
 	r.Use(middleware.StripSlashes)
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	var verifier *signing.Verifier
+	switch {
+	case len(cfg.SignKeys) > 0:
+		cfg.Logger.Info("Используется проверка подписи HMAC",
+			zap.Stringer("keys", &cfg.SignKeys),
+			zap.Bool("legacy_hash", legacyHashKey(cfg, cfg.HashKey) != ""),
+			zap.Strings("exempt", cfg.SignExempt),
+		)
+		verifier = signing.NewVerifier(cfg.SignKeys, cfg.SignSkew.Duration())
+	case !strings.EqualFold(cfg.HashKey, ""):
+		cfg.Logger.Info("Используется hash валидация", zap.Strings("exempt", cfg.SignExempt))
+	}
+
+	// Арендатор со своим ключом HashSHA256 проверяется и подписывается только им,
+	// общие KEY и ключи HMAC не дают записи в его метрики
+	tenantPolicies := make(map[string]func(http.Handler) http.Handler)
+	for name, ts := range tenants {
+		if ts.HashKey != "" {
+			tenantPolicies[name] = tenantSignaturePolicy(cfg, ts.HashKey)
+		}
+	}
+
+	// Подпись проверяется у всех запросов на запись, кроме путей из SignExempt; POST /value - чтение.
+	// Для совместимости с автотестами, которые отправляют /update без подписи, его можно добавить в SignExempt
+	// https://github.com/Yandex-Practicum/go-autotests/blob/main/cmd/metricstest/iteration14_test.go#L58
+	r.Use(perTenant(tenantPolicies, signaturePolicyFor(cfg, verifier, cfg.HashKey)))
+
 	if cfg.StoreInterval == 0 {
 		cfg.Logger.Info("Cинхронная запись метрик")
 		r.Use(writeMetrics(producer))
 	}
 
-	r.Mount("/debug", http.DefaultServeMux)
-
 	pinger := db.NewPinger(cfg.DSN)
 
-	svc := metrics.New(storage, pinger, cfg.Logger, publisher)
+	repo := newTenantRepository(storage, tenants, cfg.MaxMetrics, cfg.MaxClientMetrics)
+	svc := metrics.New(repo, pinger, cfg.Logger, publisher)
 
 	r.Post("/update/{type}/{metric}/{value}", httpx.SetMetricURL(svc))
 	r.Post("/update", httpx.SetMetricJSON(svc))
 
-	// Кастыль т.к. проверка хеша нужна для updates, проблема в тестах
-	// hard code value https://github.com/Yandex-Practicum/go-autotests/blob/main/cmd/metricstest/iteration14_test.go#L58
-	r.Group(func(r chi.Router) {
-		if !strings.EqualFold(cfg.HashKey, "") {
-			cfg.Logger.Info("Используется hash валидация")
-			r.Use(checkHash(cfg.HashKey))
-		}
-		r.Route("/updates", func(r chi.Router) {
-			r.Post("/", httpx.SetBatchMetrics(svc))
-		})
-	})
+	r.Post("/updates", httpx.SetBatchMetrics(svc))
 
 	r.Get("/", httpx.GetMetrics(svc))
 
@@ -121,15 +283,100 @@ func New(cfg *server.Config, storage storage.BasicStorage) (*Server, error) {
 
 	r.Get("/ping", httpx.Ping(svc))
 
-	return &Server{
-		Address:  domain,
-		Port:     port,
-		Router:   r,
-		Config:   cfg,
-		Storage:  storage,
-		consumer: consumer,
-		producer: producer,
-	}, nil
+	// Метрики всех арендаторов доступны только с токеном admin, без хранилища токенов маршрут не регистрируется
+	if tokenStore != nil {
+		r.Get("/admin/metrics", httpx.GetAllMetrics(svc))
+	}
+
+	scraper, err := scrape.New(scrape.Config{
+		Targets:  cfg.ScrapeTargets,
+		Interval: cfg.ScrapeInterval.Duration(),
+		Timeout:  cfg.ScrapeTimeout.Duration(),
+		Jitter:   cfg.ScrapeJitter.Duration(),
+	}, svc, cfg.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", op, err)
+	}
+
+	r.Get("/targets", httpx.GetTargets(scraper))
+	r.Get("/agents", httpx.GetAgents(agents))
+
+	var agentConfig *remoteconfig.Store
+	if cfg.AgentConfigFile != "" {
+		agentConfig, err = remoteconfig.New(cfg.AgentConfigFile, cfg.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", op, err)
+		}
+		r.Get("/agent-config", httpx.GetAgentConfig(agentConfig))
+	}
+
+	srv := &Server{
+		Address:     domain,
+		Port:        port,
+		Router:      r,
+		Config:      cfg,
+		Storage:     storage,
+		consumer:    consumer,
+		producer:    producer,
+		scraper:     scraper,
+		inventory:   agents,
+		agentConfig: agentConfig,
+		certs:       reloader,
+		tlsConfig:   tlsConfig,
+		tokens:      tokenStore,
+		audit:       publisher,
+		started:     time.Now(),
+	}
+	if cfg.AdminAddress != "" {
+		srv.admin = srv.adminRouter(tokenStore)
+	}
+	return srv, nil
+}
+
+// legacyHashKey возвращает ключ HashSHA256 hashKey. С ключами HMAC он действует только при LegacyHash.
+func legacyHashKey(cfg *server.Config, hashKey string) string {
+	if len(cfg.SignKeys) > 0 && !cfg.LegacyHash {
+		return ""
+	}
+	return hashKey
+}
+
+// requestVerifier выбирает проверку подписи запросов, nil если ключи не заданы.
+// verifier общий для всех арендаторов, чтобы запрос нельзя было повторить, сменив арендатора.
+func requestVerifier(cfg *server.Config, verifier *signing.Verifier, hashKey string) func(http.Handler) http.Handler {
+	switch {
+	case verifier != nil:
+		return checkSignature(verifier, legacyHashKey(cfg, hashKey))
+	case !strings.EqualFold(hashKey, ""):
+		return checkHash(hashKey)
+	}
+	return nil
+}
+
+// signaturePolicyFor возвращает проверку и подпись запросов с ключом HashSHA256 hashKey.
+func signaturePolicyFor(cfg *server.Config, verifier *signing.Verifier, hashKey string) func(http.Handler) http.Handler {
+	return signaturePolicy(
+		requestVerifier(cfg, verifier, hashKey),
+		signResponses(responseSigner(cfg), legacyHashKey(cfg, hashKey)),
+		cfg.SignExempt,
+	)
+}
+
+// tenantSignaturePolicy возвращает проверку и подпись запросов арендатора ключом HashSHA256 hashKey
+// независимо от SignKeys и LegacyHash.
+func tenantSignaturePolicy(cfg *server.Config, hashKey string) func(http.Handler) http.Handler {
+	return signaturePolicy(checkHash(hashKey), signResponses(signing.Signer{}, hashKey), cfg.SignExempt)
+}
+
+// responseSigner возвращает ключ подписи ответов: SignKeyID или единственный ключ из SignKeys.
+func responseSigner(cfg *server.Config) signing.Signer {
+	id := cfg.SignKeyID
+	if id == "" && len(cfg.SignKeys) == 1 {
+		for only := range cfg.SignKeys {
+			id = only
+		}
+	}
+	return signing.Signer{KeyID: id, Key: cfg.SignKeys[id]}
 }
 
 func (c *Server) logStartupInfo() {
@@ -157,13 +404,27 @@ func (c *Server) restoreMetricsFromFile() error {
 	return nil
 }
 
+// snapshot возвращает метрики всех арендаторов для записи в файл.
+func (c *Server) snapshot() (map[string]models.Metrics, error) {
+	all, err := storage.AllTenants(c.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[string]models.Metrics, len(all))
+	for _, m := range all {
+		metrics[filestorage.Key(m)] = m
+	}
+	return metrics, nil
+}
+
 func (c *Server) scheduleFilePersistence() error {
 	if c.Config.StoreInterval > 0 {
 		ticker := time.NewTicker(c.Config.StoreInterval.Duration())
 
 		go func() {
 			for range ticker.C {
-				metrics, err := c.Storage.GetAll()
+				metrics, err := c.snapshot()
 				if err != nil {
 					c.Config.Logger.Error("Ошибка при сохранении метрик", zap.Error(err))
 				}
@@ -213,9 +474,29 @@ func (c *Server) Start(ctx context.Context) error {
 		}
 	}
 
+	if len(c.Config.ScrapeTargets) > 0 {
+		c.Config.Logger.Info("Опрос агентов в режиме pull", zap.Strings("targets", c.Config.ScrapeTargets))
+		go c.scraper.Run(ctx)
+	}
+
+	go c.inventory.Watch(ctx)
+
+	if c.agentConfig != nil {
+		go c.agentConfig.Watch(ctx, agentConfigReload)
+	}
+
+	if c.certs != nil {
+		go c.certs.Watch(ctx, certReload)
+	}
+
+	admin, err := c.startAdmin()
+	if err != nil {
+		return fmt.Errorf("server.Start: %w", err)
+	}
+
 	srv := c.start()
 
-	err = c.gracefulShutdown(ctx, srv)
+	err = c.gracefulShutdown(ctx, srv, admin)
 	if err != nil {
 		return err
 	}
@@ -225,12 +506,20 @@ func (c *Server) Start(ctx context.Context) error {
 
 func (c *Server) start() *http.Server {
 	srv := &http.Server{
-		Addr:    fmt.Sprintf("%s:%v", c.Address, c.Port),
-		Handler: c.Router,
+		Addr:      fmt.Sprintf("%s:%v", c.Address, c.Port),
+		Handler:   c.Router,
+		TLSConfig: c.tlsConfig,
 	}
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if c.tlsConfig != nil {
+			// Сертификат берется из TLSConfig.GetCertificate, чтобы его можно было заменить без перезапуска
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			c.Config.Logger.Fatal("Ошибка сервера", zap.Error(err))
 		}
 	}()
@@ -238,12 +527,12 @@ func (c *Server) start() *http.Server {
 	return srv
 }
 
-func (c *Server) gracefulShutdown(ctx context.Context, srv *http.Server) error {
+func (c *Server) gracefulShutdown(ctx context.Context, srv, admin *http.Server) error {
 	op := "server.gracefulShutdown"
 
 	<-ctx.Done()
 	if _, ok := c.Storage.(*memstorage.MemStorage); ok {
-		metrics, err := c.Storage.GetAll()
+		metrics, err := c.snapshot()
 		if err != nil {
 			c.Config.Logger.Error("Ошибка при сохранении метрик", zap.Error(err))
 		}
@@ -263,5 +552,20 @@ func (c *Server) gracefulShutdown(ctx context.Context, srv *http.Server) error {
 		return fmt.Errorf("%s: Попытка остановки сервера завершилась с ошибкой: %w", op, err)
 	}
 
+	if admin != nil {
+		if err := admin.Shutdown(shutdownCtx); err != nil {
+			c.Config.Logger.Error("Ошибка при остановке служебного сервера", zap.Error(err))
+		}
+	}
+
+	// Запросы завершены, новых событий не будет: приемники дописывают очереди
+	if err := c.audit.Close(shutdownCtx); err != nil {
+		c.Config.Logger.Error("Не все события аудита доставлены", zap.Error(err))
+	}
+
+	if closer, ok := c.tokens.(io.Closer); ok {
+		closer.Close()
+	}
+
 	return nil
 }
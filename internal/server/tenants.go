@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/domain"
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/service/metrics"
+	"github.com/s0n1cAK/yandex-metrics/internal/storage"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+)
+
+// tenantRepository разделяет хранилище сервера по арендаторам и применяет квоты арендаторов и клиентов.
+type tenantRepository struct {
+	storage.BasicStorage
+	settings map[string]tenant.Settings
+	// maxMetrics - квота числа метрик арендаторов, для которых MaxMetrics не задан
+	maxMetrics int
+	// clients - квота метрик клиентов, nil без ограничения
+	clients *clientQuota
+
+	mu sync.Mutex
+	// counts ведут число метрик арендаторов с MaxMetrics
+	counts map[string]*tenantCount
+}
+
+// tenantCount - число метрик арендатора. Его mu не дает параллельным запросам вместе превысить MaxMetrics.
+// Число читается из хранилища один раз при первой записи, дальше растет на число новых метрик.
+type tenantCount struct {
+	mu     sync.Mutex
+	n      int
+	loaded bool
+}
+
+func newTenantRepository(s storage.BasicStorage, settings map[string]tenant.Settings, maxMetrics, maxClientMetrics int) *tenantRepository {
+	r := &tenantRepository{
+		BasicStorage: s,
+		settings:     settings,
+		maxMetrics:   maxMetrics,
+		counts:       make(map[string]*tenantCount),
+	}
+	if maxClientMetrics > 0 {
+		r.clients = newClientQuota(maxClientMetrics)
+	}
+	return r
+}
+
+func (r *tenantRepository) ForContext(ctx context.Context) metrics.Repository {
+	name := tenant.FromContext(ctx)
+	view, err := storage.ForTenant(r.BasicStorage, name)
+	if err != nil {
+		return errRepository{err: err}
+	}
+
+	ts := r.settings[name]
+	if ts.MaxMetrics == 0 {
+		ts.MaxMetrics = r.maxMetrics
+	}
+	client := identity.ClientFromContext(ctx)
+	if ts.MaxMetrics == 0 && ts.MaxBatch == 0 && (r.clients == nil || client == "") {
+		return view
+	}
+
+	q := &quotaRepository{Repository: view, settings: ts, tenant: name}
+	if ts.MaxMetrics > 0 {
+		q.count = r.count(name)
+	}
+	if r.clients != nil {
+		q.clients = r.clients
+		q.client = client
+	}
+	return q
+}
+
+func (r *tenantRepository) count(name string) *tenantCount {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.counts[name]
+	if !ok {
+		c = &tenantCount{}
+		r.counts[name] = c
+	}
+	return c
+}
+
+func (r *tenantRepository) GetAllTenants() ([]models.Metrics, error) {
+	return storage.AllTenants(r.BasicStorage)
+}
+
+// errRepository отвечает ошибкой err на любое обращение, например если хранилище не разделяет арендаторов.
+type errRepository struct {
+	err error
+}
+
+func (e errRepository) Set(string, models.Metrics) error { return e.err }
+
+func (e errRepository) Get(string) (models.Metrics, bool) { return models.Metrics{}, false }
+
+func (e errRepository) GetAll() (map[string]models.Metrics, error) { return nil, e.err }
+
+func (e errRepository) SetAll([]models.Metrics) error { return e.err }
+
+// quotaRepository отклоняет запись сверх квот арендатора и клиента с domain.ErrQuotaExceeded.
+type quotaRepository struct {
+	metrics.Repository
+	settings tenant.Settings
+	tenant   string
+	// count задан, только если ограничено число метрик
+	count *tenantCount
+	// clients задан, только если ограничено число метрик клиента; пустой client не ограничивается
+	clients *clientQuota
+	client  string
+}
+
+func (q *quotaRepository) Set(id string, m models.Metrics) error {
+	return q.write([]string{id}, func() error {
+		return q.Repository.Set(id, m)
+	})
+}
+
+func (q *quotaRepository) SetAll(batch []models.Metrics) error {
+	if q.settings.MaxBatch > 0 && len(batch) > q.settings.MaxBatch {
+		return fmt.Errorf("%w: batch of %d metrics, max %d", domain.ErrQuotaExceeded, len(batch), q.settings.MaxBatch)
+	}
+
+	ids := make([]string, len(batch))
+	for i, m := range batch {
+		ids[i] = m.ID
+	}
+	return q.write(ids, func() error {
+		return q.Repository.SetAll(batch)
+	})
+}
+
+// write проверяет квоты для записи метрик ids и выполняет ее.
+func (q *quotaRepository) write(ids []string, set func() error) error {
+	if q.count == nil {
+		return q.writeClient(ids, set)
+	}
+
+	q.count.mu.Lock()
+	defer q.count.mu.Unlock()
+
+	added, err := q.checkNew(ids)
+	if err != nil {
+		return err
+	}
+	if err := q.writeClient(ids, set); err != nil {
+		return err
+	}
+	q.count.n += added
+	return nil
+}
+
+// writeClient проверяет квоту клиента для записи метрик ids и выполняет ее.
+func (q *quotaRepository) writeClient(ids []string, set func() error) error {
+	if q.clients == nil || q.client == "" {
+		return set()
+	}
+
+	added, err := q.clients.admit(q.client, q.tenant, ids)
+	if err != nil {
+		return err
+	}
+	if err := set(); err != nil {
+		q.clients.release(q.client, added)
+		return err
+	}
+	return nil
+}
+
+// checkNew проверяет, что после добавления метрик ids их число не превысит MaxMetrics.
+// Возвращает число метрик, которых еще нет в хранилище. Вызывается под q.count.mu.
+func (q *quotaRepository) checkNew(ids []string) (int, error) {
+	if !q.count.loaded {
+		existing, err := q.Repository.GetAll()
+		if err != nil {
+			return 0, err
+		}
+		q.count.n = len(existing)
+		q.count.loaded = true
+	}
+
+	added := make(map[string]struct{})
+	for _, id := range ids {
+		if _, ok := added[id]; ok {
+			continue
+		}
+		if _, ok := q.Repository.Get(id); !ok {
+			added[id] = struct{}{}
+		}
+	}
+
+	if len(added) > 0 && q.count.n+len(added) > q.settings.MaxMetrics {
+		return 0, fmt.Errorf("%w: tenant has %d metrics, max %d", domain.ErrQuotaExceeded, q.count.n+len(added), q.settings.MaxMetrics)
+	}
+	return len(added), nil
+}
+
+// clientQuotaIdle - клиент, не записывавший новых метрик дольше, забывается вместе со своим учетом
+const clientQuotaIdle = 24 * time.Hour
+
+// clientQuota ограничивает число разных метрик, записанных одним клиентом.
+// Учет ведется в памяти, клиенты без записи дольше idle удаляются, чтобы учет не рос без предела.
+type clientQuota struct {
+	max  int
+	idle time.Duration
+	now  func() time.Time
+
+	mu sync.Mutex
+	// written - метрики каждого клиента по арендатору и имени
+	written   map[string]*clientMetrics
+	lastSweep time.Time
+}
+
+type clientMetrics struct {
+	keys map[metricKey]struct{}
+	// seen - время последней записи клиента
+	seen time.Time
+}
+
+type metricKey struct {
+	tenant string
+	id     string
+}
+
+func newClientQuota(max int) *clientQuota {
+	return &clientQuota{
+		max:     max,
+		idle:    clientQuotaIdle,
+		now:     time.Now,
+		written: make(map[string]*clientMetrics),
+	}
+}
+
+// sweep удаляет клиентов, не писавших дольше idle. Проходит по учету не чаще раза в idle.
+func (c *clientQuota) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.idle {
+		return
+	}
+	c.lastSweep = now
+
+	for client, m := range c.written {
+		if now.Sub(m.seen) > c.idle {
+			delete(c.written, client)
+		}
+	}
+}
+
+// admit учитывает метрики ids арендатора tenant за клиентом client, если их вместе с уже записанными не больше max.
+// Возвращает метрики, которых у клиента раньше не было.
+func (c *clientQuota) admit(client, tenant string, ids []string) ([]metricKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.sweep(now)
+
+	written := c.written[client]
+	if written != nil {
+		written.seen = now
+	}
+	var added []metricKey
+	seen := make(map[metricKey]struct{}, len(ids))
+	for _, id := range ids {
+		k := metricKey{tenant: tenant, id: id}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		if written == nil {
+			added = append(added, k)
+		} else if _, ok := written.keys[k]; !ok {
+			added = append(added, k)
+		}
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+	var count int
+	if written != nil {
+		count = len(written.keys)
+	}
+	if count+len(added) > c.max {
+		return nil, fmt.Errorf("%w: client %s writes %d metrics, max %d", domain.ErrQuotaExceeded, client, count+len(added), c.max)
+	}
+
+	if written == nil {
+		written = &clientMetrics{keys: make(map[metricKey]struct{}), seen: now}
+		c.written[client] = written
+	}
+	for _, k := range added {
+		written.keys[k] = struct{}{}
+	}
+	return added, nil
+}
+
+// release снимает с клиента метрики keys, запись которых не удалась.
+func (c *clientQuota) release(client string, keys []metricKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	written, ok := c.written[client]
+	if !ok {
+		return
+	}
+	for _, k := range keys {
+		delete(written.keys, k)
+	}
+}
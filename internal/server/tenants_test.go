@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/config/server"
+	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"github.com/s0n1cAK/yandex-metrics/internal/domain"
+	"github.com/s0n1cAK/yandex-metrics/internal/hash"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
+	"github.com/s0n1cAK/yandex-metrics/internal/storage"
+	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTenants(t *testing.T) {
+	dir := t.TempDir()
+	auditA := filepath.Join(dir, "audit-a.log")
+
+	settings := map[string]tenant.Settings{
+		"team-a": {MaxMetrics: 1, AuditFile: auditA},
+		"team-b": {HashKey: "b-key"},
+	}
+	data, err := json.Marshal(settings)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tenants.json"), data, 0o644))
+
+	store := tokens.NewFileStore(filepath.Join(dir, "tokens.json"))
+	create := func(name, tenantName string, scopes ...tokens.Scope) string {
+		value, token, err := tokens.Generate(name, scopes)
+		require.NoError(t, err)
+		token.Tenant = tenantName
+		require.NoError(t, store.Create(context.Background(), token))
+		return value
+	}
+	teamA := create("team-a-agent", "team-a", tokens.ScopeRead, tokens.ScopeWrite)
+	shared := create("agent", tenant.Default, tokens.ScopeRead, tokens.ScopeWrite)
+	admin := create("ops", tenant.Default, tokens.ScopeAdmin)
+
+	cfg := &server.Config{
+		Endpoint:    customtype.Endpoint("http://localhost:8080"),
+		Logger:      zap.NewNop(),
+		File:        filepath.Join(dir, "metrics.data"),
+		TenantsFile: filepath.Join(dir, "tenants.json"),
+		TokenStore:  filepath.Join(dir, "tokens.json"),
+	}
+	srv, err := New(cfg, memstorage.New())
+	require.NoError(t, err)
+
+	serve := func(method, path, token string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		tokens.SetHeader(req.Header, token)
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		return w
+	}
+	as := func(name string) http.Header {
+		return http.Header{tenant.Header: {name}}
+	}
+
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/cpu/1", teamA, nil).Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/cpu/2", shared, nil).Code)
+
+	// Одно имя у разных арендаторов - разные метрики
+	require.Equal(t, "1", strings.TrimSpace(serve(http.MethodGet, "/value/gauge/cpu", teamA, nil).Body.String()))
+	require.Equal(t, "2", strings.TrimSpace(serve(http.MethodGet, "/value/gauge/cpu", shared, nil).Body.String()))
+	require.Equal(t, "1", strings.TrimSpace(serve(http.MethodGet, "/value/gauge/cpu", admin, as("team-a")).Body.String()))
+
+	// Токен арендатора не выбирает другого арендатора, обычный токен без арендатора - тоже
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/value/gauge/cpu", teamA, as("team-b")).Code)
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/value/gauge/cpu", shared, as("team-a")).Code)
+
+	// Квота team-a - одна метрика, обновлять ее можно
+	require.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/update/gauge/mem/1", teamA, nil).Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/cpu/3", teamA, nil).Code)
+
+	// У team-b свой ключ HashSHA256
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/update/gauge/cpu/4", admin, as("team-b")).Code)
+	signed := as("team-b")
+	signed.Set("HashSHA256", hash.GetHashHex([]byte{}, "b-key"))
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/cpu/4", admin, signed).Code)
+
+	// Администратор видит метрики всех арендаторов
+	w := serve(http.MethodGet, "/admin/metrics", admin, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var all []models.Metrics
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &all))
+	require.Len(t, all, 3)
+	require.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/admin/metrics", teamA, nil).Code)
+
+	// Аудит team-a получает только ее события, включая отклоненную квотой запись
+	require.NoError(t, srv.audit.Close(context.Background()))
+	audit, err := os.ReadFile(auditA)
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(string(audit), `"tenant":"team-a"`))
+	require.Equal(t, 1, strings.Count(string(audit), `"event":"quota_exceeded"`))
+	require.NotContains(t, string(audit), "team-b")
+}
+
+func TestTenants_WithoutTokens(t *testing.T) {
+	dir := t.TempDir()
+	data, err := json.Marshal(map[string]tenant.Settings{"team-b": {HashKey: "b-key"}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tenants.json"), data, 0o644))
+
+	cfg := &server.Config{
+		Endpoint:    customtype.Endpoint("http://localhost:8080"),
+		Logger:      zap.NewNop(),
+		File:        filepath.Join(dir, "metrics.data"),
+		TenantsFile: filepath.Join(dir, "tenants.json"),
+		SignKeys:    signing.Keyring{"v1": "secret"},
+		SignSkew:    customtype.Time(time.Minute),
+	}
+	srv, err := New(cfg, memstorage.New())
+	require.NoError(t, err)
+
+	serve := func(tenantName string, sign func(http.Header)) int {
+		req := httptest.NewRequest(http.MethodPost, "/update/gauge/cpu/1", nil)
+		if tenantName != "" {
+			req.Header.Set(tenant.Header, tenantName)
+		}
+		sign(req.Header)
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+	hmac := func(h http.Header) {
+		signing.Signer{KeyID: "v1", Key: "secret"}.Sign(h, http.MethodPost, "/update/gauge/cpu/1", nil)
+	}
+	bKey := func(h http.Header) {
+		h.Set("HashSHA256", hash.GetHashHex([]byte{}, "b-key"))
+	}
+
+	require.Equal(t, http.StatusOK, serve(tenant.Default, hmac))
+
+	// Без токенов заголовок выбирает только арендатора из файла
+	require.Equal(t, http.StatusForbidden, serve("team-x", hmac))
+
+	// Общий ключ HMAC не дает записи арендатору со своим ключом
+	require.Equal(t, http.StatusBadRequest, serve("team-b", hmac))
+	require.Equal(t, http.StatusOK, serve("team-b", bKey))
+
+	// Без токенов метрики всех арендаторов не раскрываются
+	w := httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/metrics", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// sharedStorage - хранилище, не разделяющее арендаторов.
+type sharedStorage struct {
+	*memstorage.MemStorage
+}
+
+func TestTenantRepository_NoTenants(t *testing.T) {
+	repo := newTenantRepository(sharedStorage{memstorage.New()}, nil, 0, 0)
+
+	require.NoError(t, repo.ForContext(context.Background()).Set("cpu", models.Metrics{ID: "cpu", MType: models.Gauge, Value: new(float64)}))
+
+	err := repo.ForContext(tenant.WithContext(context.Background(), "team-a")).Set("cpu", models.Metrics{ID: "cpu", MType: models.Gauge, Value: new(float64)})
+	require.ErrorIs(t, err, storage.ErrNoTenants)
+}
+
+// scanCounter считает полные чтения хранилища.
+type scanCounter struct {
+	*memstorage.MemStorage
+	scans atomic.Int32
+}
+
+func (s *scanCounter) GetAll() (map[string]models.Metrics, error) {
+	s.scans.Add(1)
+	return s.MemStorage.GetAll()
+}
+
+func TestTenantRepository_MaxMetrics(t *testing.T) {
+	s := &scanCounter{MemStorage: memstorage.New()}
+	require.NoError(t, s.Set("cpu", models.Metrics{ID: "cpu", MType: models.Gauge, Value: new(float64)}))
+	repo := newTenantRepository(s, nil, 2, 0)
+
+	set := func(id string) error {
+		return repo.ForContext(context.Background()).Set(id, models.Metrics{ID: id, MType: models.Gauge, Value: new(float64)})
+	}
+	require.NoError(t, set("cpu"))
+	require.NoError(t, set("mem"))
+	require.ErrorIs(t, set("disk"), domain.ErrQuotaExceeded)
+	require.NoError(t, set("mem"))
+
+	// Число метрик читается из хранилища только при первой записи
+	require.Equal(t, int32(1), s.scans.Load())
+}
+
+func TestClientQuota_Idle(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	q := newClientQuota(1)
+	q.now = func() time.Time { return now }
+	q.idle = time.Hour
+
+	_, err := q.admit("ip:192.0.2.1", tenant.Default, []string{"cpu"})
+	require.NoError(t, err)
+	_, err = q.admit("ip:192.0.2.1", tenant.Default, []string{"mem"})
+	require.ErrorIs(t, err, domain.ErrQuotaExceeded)
+
+	// Клиент без записи дольше idle забывается
+	now = now.Add(2 * time.Hour)
+	_, err = q.admit("ip:192.0.2.2", tenant.Default, []string{"cpu"})
+	require.NoError(t, err)
+	require.Len(t, q.written, 1)
+	_, err = q.admit("ip:192.0.2.1", tenant.Default, []string{"mem"})
+	require.NoError(t, err)
+}
+
+func TestClientLimits(t *testing.T) {
+	dir := t.TempDir()
+	auditFile := filepath.Join(dir, "audit.log")
+
+	cfg := &server.Config{
+		Endpoint:         customtype.Endpoint("http://localhost:8080"),
+		Logger:           zap.NewNop(),
+		File:             filepath.Join(dir, "metrics.data"),
+		AuditFile:        auditFile,
+		ClientRateLimit:  0.5,
+		ClientRateBurst:  3,
+		MaxClientMetrics: 2,
+	}
+	srv, err := New(cfg, memstorage.New())
+	require.NoError(t, err)
+
+	serve := func(method, path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Клиент записывает не больше двух разных метрик, обновлять их можно
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/cpu/1", "192.0.2.1:1000").Code)
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/mem/1", "192.0.2.1:1001").Code)
+	w := serve(http.MethodPost, "/update/gauge/disk/1", "192.0.2.1:1002")
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "client ip:192.0.2.1")
+
+	// Запас из трех запросов исчерпан, следующий токен появится через 2 секунды
+	for range 2 {
+		w = serve(http.MethodPost, "/update/gauge/cpu/2", "192.0.2.1:1003")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		require.Equal(t, "2", w.Header().Get("Retry-After"))
+	}
+
+	// Адрес из заголовков не делает запрос запросом другого клиента
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/cpu/2", nil)
+	req.RemoteAddr = "192.0.2.1:1005"
+	req.Header.Set("X-Real-IP", "198.51.100.7")
+	w = httptest.NewRecorder()
+	srv.Router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Чтение и другие клиенты не ограничиваются
+	require.Equal(t, http.StatusOK, serve(http.MethodGet, "/value/gauge/cpu", "192.0.2.1:1004").Code)
+	for range 5 {
+		req := httptest.NewRequest(http.MethodPost, "/value", strings.NewReader(`{"id":"cpu","type":"gauge"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:1006"
+		w = httptest.NewRecorder()
+		srv.Router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/update/gauge/disk/1", "192.0.2.2:1000").Code)
+
+	// В аудит попадают отклоненная квотой запись и начало превышения частоты
+	require.NoError(t, srv.audit.Close(context.Background()))
+	audit, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(audit), `"event":"quota_exceeded"`))
+	require.Equal(t, 1, strings.Count(string(audit), `"event":"rate_limited"`))
+}
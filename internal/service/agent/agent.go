@@ -1,18 +1,33 @@
 package agent
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
-	"github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/certs"
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/encryption"
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
 	"github.com/s0n1cAK/yandex-metrics/internal/lib"
 	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/outbox"
+	"github.com/s0n1cAK/yandex-metrics/internal/relabel"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
+	"github.com/s0n1cAK/yandex-metrics/internal/statsd"
 	"go.uber.org/zap"
 )
 
 const fiveMinutes = time.Second * 300
 
+// ErrFinalReport возвращается из Run, если при остановке не удалось отправить последний отчет.
+var ErrFinalReport = errors.New("final report failed")
+
 type Storage interface {
 	Set(key string, value models.Metrics) error
 	Get(key string) (models.Metrics, bool)
@@ -21,38 +36,184 @@ type Storage interface {
 	Delete(key string)
 }
 
+// compareDeleter - хранилище, которое удаляет метрику, только если она не изменилась после чтения.
+// Без него значение gauge, записанное во время отправки, удаляется вместе с отправленным.
+type compareDeleter interface {
+	CompareAndDelete(key string, old models.Metrics) bool
+}
+
 type Agent struct {
-	Storage        Storage
-	Client         *retryablehttp.Client
-	Server         string
-	Logger         *zap.Logger
-	hash           string
-	PollInterval   time.Duration
-	ReportInterval time.Duration
-	httpLimiter    chan struct{}
+	Storage           Storage
+	Client            *retryablehttp.Client
+	Server            string
+	Logger            *zap.Logger
+	PollInterval      time.Duration
+	ReportInterval    time.Duration
+	mode              string
+	pullAddress       string
+	exposed           *exposition
+	targets           []*target
+	active            atomic.Int32
+	strategy          string
+	failoverThreshold int
+	probeInterval     time.Duration
+	batchSize         int
+	batchBytes        int
+	statsdAddress     string
+	statsd            *statsd.Aggregator
+	gauges            *gaugeAggregator
+	outbox            *outbox.Outbox
+	signer            signing.Signer
+	// token - токен доступа к API сервера, пустой не передается
+	token string
+	// tenant - арендатор на сервере, пустой не передается
+	tenant string
+	// encrypter шифрует отчеты открытым ключом сервера, nil отключает шифрование
+	encrypter *encryption.Encrypter
+	relabel   *relabel.Pipeline
+	// remoteConfig включает получение настроек с сервера
+	remoteConfig bool
+	// local - настройки из флагов, на которые накладываются настройки с сервера
+	local settings
+	// settings передает настройки с сервера в цикл Run
+	settings chan settings
+	// enabled - включенные сборщики, пустой список включает все
+	enabled []string
+	// identity передается серверу в заголовках каждого запроса
+	identity identity.Identity
+	self     selfMetrics
+	// selfMetricsAddress - адрес локального отладочного /metrics, пустой отключает его
+	selfMetricsAddress string
+	// ShutdownTimeout ограничивает время последней отправки при остановке
+	ShutdownTimeout time.Duration
 }
 
-func New(log *zap.Logger, storage Storage) *Agent {
-	cfg, err := agent.NewConfig(log)
+// New создает агента с конфигурацией из флагов и переменных окружения.
+func New(log *zap.Logger, storage Storage) (*Agent, error) {
+	op := "agent.New"
+
+	cfg, err := config.NewConfig(log)
 	if err != nil {
-		log.Fatal("Error while parsing env", zap.Error(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Agent{
-		Client:         cfg.Client,
-		Server:         cfg.Endpoint.String(),
-		Storage:        storage,
-		Logger:         cfg.Logger,
-		hash:           cfg.Hash,
-		PollInterval:   cfg.PollInterval.Duration(),
-		ReportInterval: cfg.ReportInterval.Duration(),
-		httpLimiter:    make(chan struct{}, cfg.RateLimit),
+	return NewFromConfig(cfg, storage)
+}
+
+// NewFromConfig создает агента с готовой конфигурацией, например собранной из config.Default.
+func NewFromConfig(cfg config.Config, storage Storage) (*Agent, error) {
+	op := "agent.NewFromConfig"
+
+	if err := config.ValidateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+
+	var err error
+	var box *outbox.Outbox
+	if cfg.OutboxDir != "" {
+		box, err = outbox.New(cfg.OutboxDir, cfg.OutboxMaxSize, cfg.OutboxMaxAge.Duration())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	targets := newTargets(cfg)
+	if err := newTargetOutboxes(cfg, targets); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var pipeline *relabel.Pipeline
+	if cfg.RelabelConfig != "" {
+		pipeline, err = relabel.Load(cfg.RelabelConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if cfg.TLSCA != "" || cfg.TLSCert != "" || cfg.TLSPin != "" {
+		tlsConfig, err := certs.ClientConfig(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey, cfg.TLSPin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		cfg.Client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	var encrypter *encryption.Encrypter
+	if cfg.CryptoKey != "" {
+		encrypter, err = encryption.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	id, err := identity.Load(cfg.AgentIDFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	id.Group = cfg.Group
+
+	metricsAgent := &Agent{
+		Client:            cfg.Client,
+		Server:            cfg.Endpoints.String(),
+		Storage:           storage,
+		Logger:            cfg.Logger,
+		PollInterval:      cfg.PollInterval.Duration(),
+		ReportInterval:    cfg.ReportInterval.Duration(),
+		mode:              cfg.Mode,
+		pullAddress:       cfg.PullAddress,
+		exposed:           newExposition(),
+		targets:           targets,
+		strategy:          cfg.Strategy,
+		failoverThreshold: cfg.FailoverErrors,
+		probeInterval:     cfg.ProbeInterval.Duration(),
+		batchSize:         cfg.BatchSize,
+		batchBytes:        cfg.BatchBytes,
+		statsdAddress:     cfg.StatsDAddress,
+		statsd:            statsd.NewAggregator(),
+		outbox:            box,
+		signer:            signing.Signer{KeyID: cfg.SignKeyID, Key: cfg.SignKey},
+		token:             cfg.Token,
+		tenant:            cfg.Tenant,
+		encrypter:         encrypter,
+		gauges:            newGaugeAggregator(cfg.Aggregation),
+		relabel:           pipeline,
+		identity:          id,
+		remoteConfig:      cfg.RemoteConfig,
+		local: settings{
+			poll:      cfg.PollInterval.Duration(),
+			report:    cfg.ReportInterval.Duration(),
+			rateLimit: cfg.RateLimit,
+		},
+		settings:           make(chan settings),
+		ShutdownTimeout:    cfg.ShutdownTimeout.Duration(),
+		selfMetricsAddress: cfg.SelfMetricsAddress,
+	}
+
+	// Нулевая попытка - исходный запрос, остальные - повторы
+	cfg.Client.RequestLogHook = func(_ retryablehttp.Logger, _ *http.Request, attempt int) {
+		if attempt > 0 {
+			metricsAgent.self.retries.Add(1)
+		}
+	}
+
+	// Повтор с прежними временем и nonce сервер отклонит как повторную отправку
+	cfg.Client.PrepareRetry = func(req *http.Request) error {
+		if metricsAgent.signer.Enabled() && signing.Signed(req.Header) {
+			metricsAgent.signer.Resign(req.Header, req.Method, req.URL.Path)
+		}
+		return nil
+	}
+
+	return metricsAgent, nil
 }
 
 // https://gosamples.dev/range-over-ticker/
 
-func (agent *Agent) Run() error {
+// Run собирает и отправляет метрики до отмены ctx.
+// При остановке выполняет последнюю отправку, ограниченную ShutdownTimeout.
+func (agent *Agent) Run(ctx context.Context) error {
 	if agent.PollInterval < time.Second {
 		return fmt.Errorf("poll can't be lower that 2 seconds")
 	}
@@ -65,6 +226,40 @@ func (agent *Agent) Run() error {
 		return fmt.Errorf("report can't be higher that 5 minutes")
 	}
 
+	if agent.statsdAddress != "" {
+		listener, err := statsd.Listen(agent.statsdAddress, agent.statsd, agent.Logger)
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+
+		go func() {
+			if err := listener.Serve(); err != nil {
+				agent.Logger.Error("StatsD listener error:", zap.Error(err))
+			}
+		}()
+
+		agent.Logger.Info("StatsD listener started", zap.String("address", listener.Addr().String()))
+	}
+
+	if agent.selfMetricsAddress != "" {
+		go agent.serveSelfMetrics(ctx)
+	}
+
+	if agent.mode == config.ModePull {
+		go func() {
+			if err := agent.servePull(ctx); err != nil {
+				agent.Logger.Error("Pull endpoint error:", zap.Error(err))
+			}
+		}()
+	} else if agent.strategy == config.StrategyFailover && len(agent.targets) > 1 {
+		go agent.probeTargets(ctx)
+	}
+
+	if agent.remoteConfig && agent.mode != config.ModePull {
+		go agent.watchConfig(ctx)
+	}
+
 	pollTicker := time.NewTicker(agent.PollInterval)
 	reportTicker := time.NewTicker(agent.ReportInterval)
 
@@ -73,23 +268,29 @@ func (agent *Agent) Run() error {
 
 	for {
 		select {
+		case <-ctx.Done():
+			pollTicker.Stop()
+			reportTicker.Stop()
+			return agent.shutdown()
+
+		case s := <-agent.settings:
+			agent.applySettings(s, pollTicker, reportTicker)
+
 		case <-pollTicker.C:
-			if err := agent.CollectRuntime(); err != nil {
-				agent.Logger.Error("CollectRuntime error:", zap.Error(err))
-			}
-			if err := agent.CollectRandomValue(); err != nil {
-				agent.Logger.Error("CollectRandomValue error:", zap.Error(err))
-			}
-			if err := agent.CollectIncrementCounter("PollCount", 1); err != nil {
-				agent.Logger.Error("CollectIncrementCounter error:", zap.Error(err))
-			}
-			if err := agent.CollectGopsutil(); err != nil {
-				agent.Logger.Error("CollectGopsutil error:", zap.Error(err))
-			}
+			agent.poll()
 
 		case <-reportTicker.C:
+			agent.flush()
+
+			if agent.mode == config.ModePull {
+				if err := agent.expose(); err != nil {
+					agent.Logger.Error("Error while exposing metrics:", zap.Error(err))
+				}
+				continue
+			}
+
 			agent.Logger.Info("Reporting metrics")
-			err := agent.Report()
+			err := agent.Report(ctx)
 			if err != nil {
 				agent.Logger.Error("Error while reporting:", zap.Error(err))
 			}
@@ -97,20 +298,125 @@ func (agent *Agent) Run() error {
 	}
 }
 
+// collector - именованный источник метрик, опрашиваемый на каждом тике poll
+type collector struct {
+	name    string
+	collect func() error
+}
+
+func (agent *Agent) collectors() []collector {
+	return []collector{
+		{name: "runtime", collect: agent.CollectRuntime},
+		{name: "random", collect: agent.CollectRandomValue},
+		{name: "poll_count", collect: func() error { return agent.CollectIncrementCounter("PollCount", 1) }},
+		{name: "gopsutil", collect: agent.CollectGopsutil},
+	}
+}
+
+func (agent *Agent) poll() {
+	for _, c := range agent.collectors() {
+		if len(agent.enabled) > 0 && !slices.Contains(agent.enabled, c.name) {
+			continue
+		}
+
+		start := time.Now()
+		err := c.collect()
+		agent.self.observeCollector(c.name, time.Since(start), err)
+		if err != nil {
+			agent.Logger.Error("Collector error:", zap.String("collector", c.name), zap.Error(err))
+		}
+	}
+}
+
+// flush переносит в хранилище значения, накопленные за окно отчета.
+func (agent *Agent) flush() {
+	if err := agent.CollectStatsD(); err != nil {
+		agent.Logger.Error("CollectStatsD error:", zap.Error(err))
+	}
+	if err := agent.CollectSelf(); err != nil {
+		agent.Logger.Error("CollectSelf error:", zap.Error(err))
+	}
+	if err := agent.flushGauges(); err != nil {
+		agent.Logger.Error("flushGauges error:", zap.Error(err))
+	}
+}
+
+// shutdown отправляет все, что накопилось с последнего отчета.
+// В режиме pull отправлять нечего, метрики перестают отдаваться вместе с остановкой агента.
+func (agent *Agent) shutdown() error {
+	if agent.mode == config.ModePull {
+		agent.Logger.Info("Stopping agent")
+		return nil
+	}
+
+	agent.Logger.Info("Stopping agent, sending final report", zap.Duration("timeout", agent.ShutdownTimeout))
+
+	timeout := agent.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = reportTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	agent.flush()
+
+	if err := agent.Report(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrFinalReport, err)
+	}
+
+	agent.Logger.Info("Final report sent")
+	return nil
+}
+
+// Без агрегатора каждое значение gauge хранится под уникальным ключом
 func (agent *Agent) updateGaugeMetruc(name string, value float64) error {
+	if agent.gauges != nil {
+		agent.gauges.Add(name, value)
+		return nil
+	}
+
 	err := agent.Storage.Set(uniqMetric(name), models.Metrics{
 		ID:    name,
 		MType: models.Gauge,
 		Value: lib.FloatPtr(value),
 	})
+	if err != nil {
+		agent.self.dropped.Add(1)
+	}
 	return err
 }
 
+// Счетчики хранятся под своим именем, чтобы хранилище суммировало их между отчетами
 func (agent *Agent) updateCounterMetruc(name string, value int64) error {
-	err := agent.Storage.Set(uniqMetric(name), models.Metrics{
+	err := agent.Storage.Set(name, models.Metrics{
 		ID:    name,
 		MType: models.Counter,
 		Delta: lib.IntPtr(value),
 	})
+	if err != nil {
+		agent.self.dropped.Add(1)
+	}
 	return err
 }
+
+// flushGauges записывает в хранилище результат агрегации gauge за окно отчета.
+// Агрегированное значение хранится под именем метрики, значения режима all - под уникальными ключами.
+func (agent *Agent) flushGauges() error {
+	if agent.gauges == nil {
+		return nil
+	}
+
+	for i, metric := range agent.gauges.Flush() {
+		key := metric.ID
+		if agent.gauges.cfg.Mode(metric.ID) == config.AggregationAll {
+			key = fmt.Sprintf("%s-%d", uniqMetric(metric.ID), i)
+		}
+
+		if err := agent.Storage.Set(key, metric); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
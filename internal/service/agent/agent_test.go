@@ -1,5 +1,42 @@
 package agent
 
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_RunFinalReport(t *testing.T) {
+	var received atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+	agent.PollInterval = time.Second
+	agent.ReportInterval = time.Minute
+	agent.ShutdownTimeout = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	require.NoError(t, agent.Run(ctx))
+	require.Equal(t, int32(1), received.Load())
+
+	// После последнего отчета в хранилище не остается неотправленных счетчиков
+	metric, ok := agent.Storage.Get("PollCount")
+	require.True(t, ok)
+	require.Equal(t, int64(0), *metric.Delta)
+}
+
 // import (
 // 	"net/http"
 // 	"testing"
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"math"
+	"sync"
+
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+)
+
+// gaugeWindow - значения одной метрики за окно между отчетами
+type gaugeWindow struct {
+	last    float64
+	min     float64
+	max     float64
+	sum     float64
+	count   int
+	samples []float64
+}
+
+// gaugeAggregator сворачивает значения gauge за окно отчета в одно значение
+// согласно режиму, выбранному для метрики.
+type gaugeAggregator struct {
+	mu      sync.Mutex
+	cfg     config.Aggregation
+	windows map[string]*gaugeWindow
+}
+
+func newGaugeAggregator(cfg config.Aggregation) *gaugeAggregator {
+	return &gaugeAggregator{
+		cfg:     cfg,
+		windows: make(map[string]*gaugeWindow),
+	}
+}
+
+func (a *gaugeAggregator) Add(name string, value float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.windows[name]
+	if !ok {
+		w = &gaugeWindow{min: math.Inf(1), max: math.Inf(-1)}
+		a.windows[name] = w
+	}
+
+	w.last = value
+	w.min = math.Min(w.min, value)
+	w.max = math.Max(w.max, value)
+	w.sum += value
+	w.count++
+
+	if a.cfg.Mode(name) == config.AggregationAll {
+		w.samples = append(w.samples, value)
+	}
+}
+
+// Flush возвращает результат агрегации и начинает новое окно.
+// В режиме all возвращаются все значения окна.
+func (a *gaugeAggregator) Flush() []models.Metrics {
+	a.mu.Lock()
+	windows := a.windows
+	a.windows = make(map[string]*gaugeWindow, len(windows))
+	a.mu.Unlock()
+
+	result := make([]models.Metrics, 0, len(windows))
+	for name, w := range windows {
+		var value float64
+
+		switch a.cfg.Mode(name) {
+		case config.AggregationAll:
+			for _, v := range w.samples {
+				result = append(result, models.Metrics{ID: name, MType: models.Gauge, Value: lib.FloatPtr(v)})
+			}
+			continue
+		case config.AggregationMin:
+			value = w.min
+		case config.AggregationMax:
+			value = w.max
+		case config.AggregationAvg:
+			value = w.sum / float64(w.count)
+		default:
+			value = w.last
+		}
+
+		result = append(result, models.Metrics{ID: name, MType: models.Gauge, Value: lib.FloatPtr(value)})
+	}
+
+	return result
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"testing"
+
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGaugeAggregator_Modes(t *testing.T) {
+	var cfg config.Aggregation
+	require.NoError(t, cfg.Set("avg,Min=min,Max=max,Last=last,All=all"))
+
+	a := newGaugeAggregator(cfg)
+	for _, name := range []string{"Avg", "Min", "Max", "Last", "All"} {
+		for _, v := range []float64{3, 1, 2} {
+			a.Add(name, v)
+		}
+	}
+
+	values := make(map[string][]float64)
+	for _, m := range a.Flush() {
+		values[m.ID] = append(values[m.ID], *m.Value)
+	}
+
+	require.Equal(t, []float64{2}, values["Avg"])
+	require.Equal(t, []float64{1}, values["Min"])
+	require.Equal(t, []float64{3}, values["Max"])
+	require.Equal(t, []float64{2}, values["Last"])
+	require.Equal(t, []float64{3, 1, 2}, values["All"])
+
+	require.Empty(t, a.Flush())
+}
+
+func TestAggregation_Set(t *testing.T) {
+	var cfg config.Aggregation
+	require.Error(t, cfg.Set("median"))
+	require.Error(t, cfg.Set("HeapAlloc=sum"))
+
+	require.NoError(t, cfg.Set("HeapAlloc=max"))
+	require.Equal(t, config.AggregationLast, cfg.Mode("Alloc"))
+	require.Equal(t, config.AggregationMax, cfg.Mode("HeapAlloc"))
+}
+
+func TestAgent_FlushGauges(t *testing.T) {
+	storage := memstorage.New()
+	agent := &Agent{
+		Storage: storage,
+		gauges:  newGaugeAggregator(config.DefaultAggregation),
+	}
+
+	require.NoError(t, agent.CollectRandomValue())
+	require.NoError(t, agent.CollectRandomValue())
+
+	s, _ := storage.GetAll()
+	require.Empty(t, s)
+
+	require.NoError(t, agent.flushGauges())
+
+	metric, ok := storage.Get(MetricNameRandomValue)
+	require.True(t, ok)
+	require.Equal(t, models.Gauge, metric.MType)
+
+	s, _ = storage.GetAll()
+	require.Len(t, s, 1)
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/relabel"
+)
+
+// reportItem - метрика вместе с ключом, под которым она лежит в хранилище.
+// metric отправляется на сервер, stored - значение из хранилища до применения правил relabel,
+// по нему хранилище освобождается после отправки. baseline сохраняется в правилах relabel после отправки.
+type reportItem struct {
+	key      string
+	metric   models.Metrics
+	stored   models.Metrics
+	baseline relabel.Baseline
+}
+
+// reportChunk - часть отчета, отправляемая одним запросом
+type reportChunk struct {
+	items   []reportItem
+	payload []byte
+}
+
+func (c reportChunk) metrics() []models.Metrics {
+	metrics := make([]models.Metrics, 0, len(c.items))
+	for _, item := range c.items {
+		metrics = append(metrics, item.metric)
+	}
+	return metrics
+}
+
+// splitChunks делит метрики на части не больше maxCount штук и maxBytes байт JSON.
+// Нулевой лимит не ограничивает соответствующий размер.
+// Метрика, которая сама больше maxBytes, отправляется отдельной частью.
+func splitChunks(items []reportItem, maxCount, maxBytes int) ([]reportChunk, error) {
+	var chunks []reportChunk
+	var current reportChunk
+	var buf bytes.Buffer
+
+	closeChunk := func() {
+		if len(current.items) == 0 {
+			return
+		}
+		buf.WriteByte(']')
+		current.payload = bytes.Clone(buf.Bytes())
+		chunks = append(chunks, current)
+		current = reportChunk{}
+		buf.Reset()
+	}
+
+	for _, item := range items {
+		data, err := json.Marshal(item.metric)
+		if err != nil {
+			return nil, err
+		}
+
+		// +2 байта на разделитель и закрывающую скобку
+		if len(current.items) > 0 {
+			full := maxCount > 0 && len(current.items) >= maxCount
+			tooBig := maxBytes > 0 && buf.Len()+len(data)+2 > maxBytes
+			if full || tooBig {
+				closeChunk()
+			}
+		}
+
+		if len(current.items) == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(data)
+		current.items = append(current.items, item)
+	}
+	closeChunk()
+
+	return chunks, nil
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func gaugeItems(n int) []reportItem {
+	items := make([]reportItem, 0, n)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("Gauge%d", i)
+		items = append(items, reportItem{
+			key:    id,
+			metric: models.Metrics{ID: id, MType: models.Gauge, Value: lib.FloatPtr(float64(i))},
+		})
+	}
+	return items
+}
+
+func TestSplitChunks(t *testing.T) {
+	items := gaugeItems(10)
+
+	chunks, err := splitChunks(items, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+
+	chunks, err = splitChunks(items, 3, 0)
+	require.NoError(t, err)
+	require.Len(t, chunks, 4)
+	require.Len(t, chunks[3].items, 1)
+
+	chunks, err = splitChunks(items, 0, 100)
+	require.NoError(t, err)
+	require.Greater(t, len(chunks), 1)
+
+	total := 0
+	for _, chunk := range chunks {
+		require.LessOrEqual(t, len(chunk.payload), 100)
+
+		var decoded []models.Metrics
+		require.NoError(t, json.Unmarshal(chunk.payload, &decoded))
+		require.Equal(t, chunk.metrics(), decoded)
+		total += len(decoded)
+	}
+	require.Equal(t, 10, total)
+}
+
+func TestAgent_ReportPartialFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(gz).Decode(&batch))
+
+		for _, m := range batch {
+			if m.ID == "Gauge0" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+	agent.batchSize = 1
+	agent.targets = []*target{newTarget(srv.URL, "", 2)}
+
+	for _, item := range gaugeItems(5) {
+		require.NoError(t, agent.Storage.Set(item.key, item.metric))
+	}
+
+	require.Error(t, agent.Report(context.Background()))
+
+	// В хранилище остается только неподтвержденная часть
+	left, err := agent.Storage.GetAll()
+	require.NoError(t, err)
+	require.Len(t, left, 1)
+	require.Contains(t, left, "Gauge0")
+}
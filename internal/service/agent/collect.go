@@ -7,6 +7,7 @@ import (
 	"runtime"
 	"time"
 
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
 	"github.com/shirou/gopsutil/v4/mem"
 	"golang.org/x/sync/errgroup"
 )
@@ -111,6 +112,36 @@ func (agent *Agent) CollectIncrementCounter(ID string, value int64) error {
 	return nil
 }
 
+// CollectStatsD переносит накопленные с прошлого отчета значения StatsD в хранилище.
+func (agent *Agent) CollectStatsD() error {
+	op := "agent.CollectStatsD"
+
+	if agent.statsd == nil {
+		return nil
+	}
+
+	for _, metric := range agent.statsd.Flush() {
+		// Префикс зарезервирован за метриками самого агента
+		if isSelfMetric(metric.ID) {
+			agent.self.dropped.Add(1)
+			continue
+		}
+
+		var err error
+		switch metric.MType {
+		case models.Counter:
+			err = agent.updateCounterMetruc(metric.ID, *metric.Delta)
+		case models.Gauge:
+			err = agent.updateGaugeMetruc(metric.ID, *metric.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: Error: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
 func (agent *Agent) CollectGopsutil() error {
 	op := "agent.CollectGopsutil"
 
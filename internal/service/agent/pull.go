@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// exposition - метрики, отдаваемые агентом в режиме pull.
+// Счетчики накапливаются с момента запуска, gauge хранят последнее значение.
+type exposition struct {
+	mu      sync.RWMutex
+	metrics map[string]models.Metrics
+}
+
+func newExposition() *exposition {
+	return &exposition{metrics: make(map[string]models.Metrics)}
+}
+
+func (e *exposition) update(items []reportItem) {
+	// Без агрегатора значения одного gauge хранятся под ключами с отметкой времени,
+	// сортировка по ключу оставляет последнее из них
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key < items[j].key
+	})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, item := range items {
+		metric := item.metric
+		switch metric.MType {
+		case models.Gauge:
+			if metric.Value == nil {
+				continue
+			}
+			value := *metric.Value
+			e.metrics[metric.ID] = models.Metrics{ID: metric.ID, MType: models.Gauge, Value: &value}
+		case models.Counter:
+			if metric.Delta == nil {
+				continue
+			}
+			delta := *metric.Delta
+			if prev, ok := e.metrics[metric.ID]; ok && prev.MType == models.Counter {
+				delta += *prev.Delta
+			}
+			e.metrics[metric.ID] = models.Metrics{ID: metric.ID, MType: models.Counter, Delta: &delta}
+		}
+	}
+}
+
+func (e *exposition) snapshot() []models.Metrics {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	result := make([]models.Metrics, 0, len(e.metrics))
+	for _, metric := range e.metrics {
+		result = append(result, metric)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
+
+// expose переносит накопленные в хранилище метрики в отдаваемый набор.
+func (agent *Agent) expose() error {
+	op := "Agent.expose"
+
+	items, err := agent.pending()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	agent.exposed.update(items)
+	agent.acknowledge(items)
+
+	return nil
+}
+
+// servePull отдает метрики на /metrics до отмены ctx.
+func (agent *Agent) servePull(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", agent.metricsHandler)
+
+	srv := &http.Server{
+		Addr:              agent.pullAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	agent.Logger.Info("Serving metrics for scraping", zap.String("address", agent.pullAddress))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// metricsHandler отдает метрики в формате Prometheus, а при format=json
+// или Accept: application/json - в формате []models.Metrics, как их принимает сервер.
+func (agent *Agent) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics := agent.exposed.snapshot()
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(metrics)
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	_ = writePrometheus(w, metrics)
+}
+
+// writePrometheus записывает метрики в текстовом формате Prometheus.
+func writePrometheus(w io.Writer, metrics []models.Metrics) error {
+	names := prometheusNames(metrics)
+	for i, metric := range metrics {
+		name := names[i]
+
+		var value string
+		switch metric.MType {
+		case models.Counter:
+			value = strconv.FormatInt(*metric.Delta, 10)
+		case models.Gauge:
+			value = strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+		default:
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n%s %s\n", name, metric.MType, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prometheusNames возвращает имена метрик для Prometheus без совпадений.
+// Имя, которое после замены символов совпало с другим, например a.b и a_b, получает суффикс из хеша исходного имени.
+// Допустимые имена не меняются, поэтому a_b остается a_b при любом наборе метрик.
+func prometheusNames(metrics []models.Metrics) []string {
+	names := make([]string, len(metrics))
+	used := make(map[string]struct{}, len(metrics))
+	for i, metric := range metrics {
+		names[i] = prometheusName(metric.ID)
+		if names[i] == metric.ID {
+			used[names[i]] = struct{}{}
+		}
+	}
+
+	for i, metric := range metrics {
+		if names[i] == metric.ID {
+			continue
+		}
+		if _, ok := used[names[i]]; ok {
+			h := fnv.New32a()
+			h.Write([]byte(metric.ID))
+			names[i] = fmt.Sprintf("%s_%08x", names[i], h.Sum32())
+		}
+		used[names[i]] = struct{}{}
+	}
+	return names
+}
+
+// prometheusName заменяет недопустимые в Prometheus символы имени на подчеркивание.
+func prometheusName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
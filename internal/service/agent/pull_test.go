@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Expose(t *testing.T) {
+	agent := newTestAgent(t, "http://localhost")
+	agent.exposed = newExposition()
+
+	require.NoError(t, agent.CollectIncrementCounter("PollCount", 2))
+	require.NoError(t, agent.updateGaugeMetruc("HeapAlloc", 1))
+	require.NoError(t, agent.expose())
+
+	require.NoError(t, agent.CollectIncrementCounter("PollCount", 3))
+	require.NoError(t, agent.updateGaugeMetruc("HeapAlloc", 2.5))
+	require.NoError(t, agent.expose())
+
+	// Хранилище освобождается после переноса
+	stored, err := agent.Storage.GetAll()
+	require.NoError(t, err)
+	for _, metric := range stored {
+		require.Equal(t, models.Counter, metric.MType)
+		require.Zero(t, *metric.Delta)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(agent.metricsHandler))
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	require.Equal(t, prometheusContentType, response.Header.Get("Content-Type"))
+	require.Equal(t, "# TYPE HeapAlloc gauge\nHeapAlloc 2.5\n# TYPE PollCount counter\nPollCount 5\n", string(body))
+
+	request, err := http.NewRequest(http.MethodGet, srv.URL+"/metrics", nil)
+	require.NoError(t, err)
+	request.Header.Set("Accept", "application/json")
+
+	response, err = http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	var metrics []models.Metrics
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&metrics))
+	require.Len(t, metrics, 2)
+	require.Equal(t, int64(5), *metrics[1].Delta)
+}
+
+func TestPrometheusName(t *testing.T) {
+	require.Equal(t, "agent_breaker_state_localhost_8080", prometheusName("agent_breaker_state_localhost_8080"))
+	require.Equal(t, "api_latency_p95", prometheusName("api.latency.p95"))
+	require.Equal(t, "_9lives", prometheusName("9lives"))
+}
+
+func TestPrometheusNames_Collision(t *testing.T) {
+	metrics := []models.Metrics{{ID: "a.b"}, {ID: "a_b"}, {ID: "a-b"}}
+	names := prometheusNames(metrics)
+
+	require.Equal(t, "a_b", names[1])
+	require.NotEqual(t, names[0], names[2])
+	require.Contains(t, names[0], "a_b_")
+	require.Contains(t, names[2], "a_b_")
+
+	// Суффикс зависит только от исходного имени
+	require.Equal(t, names[0], prometheusNames([]models.Metrics{{ID: "a_b"}, {ID: "a.b"}})[1])
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/remoteconfig"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+	"go.uber.org/zap"
+)
+
+const (
+	// configWait - сколько сервер держит запрос настроек, если они не менялись
+	configWait = 30 * time.Second
+	// configRetry - пауза после неудачного запроса настроек
+	configRetry = 10 * time.Second
+)
+
+var ErrConfigUnavailable = errors.New("remote config is not served")
+
+// settings - параметры агента, которые можно менять без перезапуска
+type settings struct {
+	poll       time.Duration
+	report     time.Duration
+	rateLimit  int
+	collectors []string
+}
+
+// resolveSettings накладывает документ с сервера на локальные настройки из флагов.
+// Поля, которых нет в документе, берутся из local.
+func (agent *Agent) resolveSettings(doc remoteconfig.Document) (settings, error) {
+	s := agent.local
+
+	if doc.PollInterval != nil {
+		s.poll = doc.PollInterval.Duration()
+	}
+	if doc.ReportInterval != nil {
+		s.report = doc.ReportInterval.Duration()
+	}
+	if doc.RateLimit != nil {
+		s.rateLimit = *doc.RateLimit
+	}
+	if len(doc.Collectors) > 0 {
+		s.collectors = doc.Collectors
+	}
+
+	switch {
+	case s.poll < time.Second:
+		return settings{}, fmt.Errorf("poll interval %s is lower than 1s", s.poll)
+	case s.poll > s.report:
+		return settings{}, fmt.Errorf("poll interval %s is higher than report interval %s", s.poll, s.report)
+	case s.report > fiveMinutes:
+		return settings{}, fmt.Errorf("report interval %s is higher than 5 minutes", s.report)
+	case s.rateLimit <= 0:
+		return settings{}, fmt.Errorf("rate limit must be > 0")
+	}
+
+	for _, name := range s.collectors {
+		if !slices.ContainsFunc(agent.collectors(), func(c collector) bool { return c.name == name }) {
+			return settings{}, fmt.Errorf("unknown collector %q", name)
+		}
+	}
+
+	return s, nil
+}
+
+// applySettings применяет настройки. Вызывается только из цикла Run.
+func (agent *Agent) applySettings(s settings, pollTicker, reportTicker *time.Ticker) {
+	if s.poll != agent.PollInterval {
+		agent.PollInterval = s.poll
+		pollTicker.Reset(s.poll)
+	}
+	if s.report != agent.ReportInterval {
+		agent.ReportInterval = s.report
+		reportTicker.Reset(s.report)
+	}
+	for _, t := range agent.targets {
+		t.setRateLimit(s.rateLimit)
+	}
+	agent.enabled = s.collectors
+
+	agent.Logger.Info("Settings applied",
+		zap.Duration("poll_interval", s.poll),
+		zap.Duration("report_interval", s.report),
+		zap.Int("rate_limit", s.rateLimit),
+		zap.Strings("collectors", s.collectors),
+	)
+}
+
+// watchConfig ждет изменений настроек на сервере и передает их в цикл Run.
+// Пока сервер недоступен, действуют локальные флаги: после восстановления связи
+// настройки с сервера запрашиваются заново.
+func (agent *Agent) watchConfig(ctx context.Context) {
+	var etag string
+	// remote - действуют настройки с сервера
+	var remote bool
+
+	for ctx.Err() == nil {
+		start := time.Now()
+		doc, newETag, modified, err := agent.fetchConfig(ctx, etag)
+		if err != nil {
+			if !remote {
+				agent.Logger.Debug("Remote config unavailable", zap.Error(err))
+			} else {
+				agent.Logger.Warn("Remote config unavailable, falling back to local settings", zap.Error(err))
+				if !agent.sendSettings(ctx, agent.local) {
+					return
+				}
+				remote = false
+				etag = ""
+			}
+			if !sleepContext(ctx, configRetry) {
+				return
+			}
+			continue
+		}
+
+		if !modified {
+			// Сервер без ожидания изменений отвечает сразу, запросы не должны идти подряд
+			if !sleepContext(ctx, configRetry-time.Since(start)) {
+				return
+			}
+			continue
+		}
+		etag = newETag
+
+		s, err := agent.resolveSettings(doc)
+		if err != nil {
+			agent.Logger.Warn("Remote config rejected", zap.String("etag", etag), zap.Error(err))
+			continue
+		}
+
+		if !agent.sendSettings(ctx, s) {
+			return
+		}
+		remote = true
+	}
+}
+
+// sendSettings передает настройки в цикл Run. Возвращает false, если ctx отменен.
+func (agent *Agent) sendSettings(ctx context.Context, s settings) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case agent.settings <- s:
+		return true
+	}
+}
+
+// sleepContext ждет d или отмены ctx. Возвращает false, если ctx отменен.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// fetchConfig запрашивает настройки у активного адреса сервера.
+// Если настройки не менялись, возвращает false.
+func (agent *Agent) fetchConfig(ctx context.Context, etag string) (remoteconfig.Document, string, bool, error) {
+	t := agent.targets[agent.active.Load()]
+
+	ctx, cancel := context.WithTimeout(ctx, configWait+reportTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/agent-config?wait=%s", t.server, configWait)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return remoteconfig.Document{}, "", false, err
+	}
+	agent.identity.SetHeaders(request.Header)
+	tokens.SetHeader(request.Header, agent.token)
+	if agent.tenant != "" {
+		request.Header.Set(tenant.Header, agent.tenant)
+	}
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	client := http.DefaultClient
+	if agent.Client != nil && agent.Client.HTTPClient != nil {
+		client = agent.Client.HTTPClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return remoteconfig.Document{}, "", false, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return remoteconfig.Document{}, etag, false, nil
+	case http.StatusNotFound:
+		return remoteconfig.Document{}, "", false, ErrConfigUnavailable
+	default:
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return remoteconfig.Document{}, "", false, fmt.Errorf("bad status: %s; body: %s", response.Status, string(body))
+	}
+
+	var doc remoteconfig.Document
+	if err := json.NewDecoder(response.Body).Decode(&doc); err != nil {
+		return remoteconfig.Document{}, "", false, err
+	}
+
+	return doc, response.Header.Get("ETag"), true, nil
+}
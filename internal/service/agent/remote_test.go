@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
+	"github.com/s0n1cAK/yandex-metrics/internal/remoteconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_FetchConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/agent-config", r.URL.Path)
+		require.Equal(t, "a1", r.Header.Get(identity.HeaderID))
+		require.Equal(t, "web", r.Header.Get(identity.HeaderGroup))
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"report_interval":"20s","collectors":["runtime"]}`))
+	}))
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+	agent.identity = identity.Identity{ID: "a1", Group: "web"}
+
+	doc, etag, modified, err := agent.fetchConfig(context.Background(), "")
+	require.NoError(t, err)
+	require.True(t, modified)
+	require.Equal(t, `"v1"`, etag)
+	require.Equal(t, 20*time.Second, doc.ReportInterval.Duration())
+
+	_, _, modified, err = agent.fetchConfig(context.Background(), etag)
+	require.NoError(t, err)
+	require.False(t, modified)
+}
+
+func TestAgent_WatchConfig(t *testing.T) {
+	var requests atomic.Int32
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") != "" {
+			if down.Load() {
+				panic(http.ErrAbortHandler)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"report_interval":"20s"}`))
+	}))
+	defer srv.Close()
+
+	watch := func(t *testing.T) (*Agent, context.CancelFunc) {
+		agent := newTestAgent(t, srv.URL)
+		agent.local = settings{poll: 2 * time.Second, report: 10 * time.Second, rateLimit: 1}
+		agent.settings = make(chan settings)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go agent.watchConfig(ctx)
+
+		s := <-agent.settings
+		require.Equal(t, 20*time.Second, s.report)
+		return agent, cancel
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		requests.Store(0)
+		_, cancel := watch(t)
+		defer cancel()
+
+		// Ответ 304 без ожидания не приводит к запросам подряд
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		down.Store(true)
+		agent, cancel := watch(t)
+		defer cancel()
+
+		select {
+		case s := <-agent.settings:
+			require.Equal(t, agent.local, s)
+		case <-time.After(time.Second):
+			t.Fatal("local settings were not restored")
+		}
+	})
+}
+
+func TestAgent_ResolveSettings(t *testing.T) {
+	agent := newTestAgent(t, "http://localhost")
+	agent.local = settings{poll: 2 * time.Second, report: 10 * time.Second, rateLimit: 1}
+
+	report := customtype.Time(30 * time.Second)
+	s, err := agent.resolveSettings(remoteconfig.Document{ReportInterval: &report, Collectors: []string{"runtime"}})
+	require.NoError(t, err)
+	require.Equal(t, settings{poll: 2 * time.Second, report: 30 * time.Second, rateLimit: 1, collectors: []string{"runtime"}}, s)
+
+	// Пустой документ возвращает локальные настройки
+	s, err = agent.resolveSettings(remoteconfig.Document{})
+	require.NoError(t, err)
+	require.Equal(t, agent.local, s)
+
+	poll := customtype.Time(time.Minute)
+	_, err = agent.resolveSettings(remoteconfig.Document{PollInterval: &poll})
+	require.Error(t, err)
+
+	_, err = agent.resolveSettings(remoteconfig.Document{Collectors: []string{"unknown"}})
+	require.Error(t, err)
+
+	pollTicker, reportTicker := time.NewTicker(time.Hour), time.NewTicker(time.Hour)
+	defer pollTicker.Stop()
+	defer reportTicker.Stop()
+
+	agent.applySettings(settings{poll: time.Second, report: 5 * time.Second, rateLimit: 4, collectors: []string{"random"}}, pollTicker, reportTicker)
+	require.Equal(t, 5*time.Second, agent.ReportInterval)
+	require.Equal(t, 4, cap(agent.targets[0].currentLimiter()))
+
+	// Включен только сборщик RandomValue
+	agent.poll()
+	stored, err := agent.Storage.GetAll()
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+}
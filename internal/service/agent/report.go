@@ -5,94 +5,354 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
+	"github.com/s0n1cAK/yandex-metrics/internal/encryption"
 	"github.com/s0n1cAK/yandex-metrics/internal/hash"
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
 	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/outbox"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+	"go.uber.org/zap"
 )
 
-func (agent *Agent) Report() error {
+const reportTimeout = 5 * time.Second
+
+// statusError - ответ сервера с кодом, отличным от 200.
+type statusError struct {
+	code   int
+	status string
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("bad status: %s; body: %s", e.status, e.body)
+}
+
+// rejected сообщает, что сервер отклонил пакет и повтор не поможет: ответ 4xx, кроме 408 и 429.
+func rejected(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	if se.code == http.StatusRequestTimeout || se.code == http.StatusTooManyRequests {
+		return false
+	}
+	return se.code >= http.StatusBadRequest && se.code < http.StatusInternalServerError
+}
+
+func (agent *Agent) Report(ctx context.Context) (err error) {
 	op := "Agent.Report"
 
-	stotageMetrics, err := agent.Storage.GetAll()
+	start := time.Now()
+	var payloadSize int
+	defer func() {
+		agent.self.observeReport(time.Since(start), payloadSize, err)
+	}()
+
+	items, err := agent.pending()
 	if err != nil {
 		return fmt.Errorf("%s: %s", op, err)
 	}
 
-	metrics := make([]models.Metrics, 0, len(stotageMetrics))
+	chunks, err := splitChunks(items, agent.batchSize, agent.batchBytes)
+	if err != nil {
+		return fmt.Errorf("%s: %s", op, err)
+	}
+
+	for _, chunk := range chunks {
+		payloadSize += len(chunk.payload)
+	}
+
+	// Пакеты из очереди отправляются раньше текущих, чтобы сохранить порядок
+	if err := agent.replayOutbox(ctx); err != nil {
+		for _, chunk := range chunks {
+			agent.spool(chunk)
+		}
+		return fmt.Errorf("%s: %s", op, err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	// Одновременность ограничивается ограничителем адреса внутри requestWithLimit
+	for _, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := agent.send(ctx, chunk.payload); err != nil {
+				agent.spool(chunk)
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+
+			agent.acknowledge(chunk.items)
+		}()
+	}
+	wg.Wait()
 
-	for _, metric := range stotageMetrics {
-		metrics = append(metrics, metric)
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %d of %d chunks failed: %w", op, len(errs), len(chunks), errors.Join(errs...))
 	}
 
-	endpoint := fmt.Sprintf("%s/updates", agent.Server)
+	return nil
+}
 
-	payload, err := json.Marshal(metrics)
+// pending возвращает метрики хранилища, подготовленные к отправке.
+// Метрики, отброшенные правилами relabel, сразу удаляются из хранилища.
+func (agent *Agent) pending() ([]reportItem, error) {
+	stored, err := agent.Storage.GetAll()
 	if err != nil {
-		return fmt.Errorf("%s: %s", op, err)
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(stored))
+	for key := range stored {
+		keys = append(keys, key)
 	}
+	// Ключи значений gauge содержат время, порядок важен для gauge_to_counter
+	sort.Strings(keys)
+
+	items := make([]reportItem, 0, len(stored))
+	var dropped []reportItem
+	session := agent.relabel.NewSession()
+
+	for _, key := range keys {
+		metric := stored[key]
+		// Сервер не принимает нулевые счетчики, а они остаются после успешной отправки
+		if metric.MType == models.Counter && (metric.Delta == nil || *metric.Delta == 0) {
+			continue
+		}
 
-	hash := hash.GetHashHex(payload, agent.hash)
+		relabeled, baseline, ok := session.Apply(metric)
+		if !ok {
+			dropped = append(dropped, reportItem{key: key, metric: metric, stored: metric})
+			continue
+		}
+		items = append(items, reportItem{key: key, metric: relabeled, stored: metric, baseline: baseline})
+	}
+
+	agent.acknowledge(dropped)
+
+	return items, nil
+}
+
+// spool сохраняет неотправленную часть отчета в очередь на диске и освобождает хранилище.
+// Без очереди метрики остаются в хранилище до следующей попытки.
+func (agent *Agent) spool(chunk reportChunk) {
+	if agent.outbox == nil {
+		return
+	}
+
+	if err := agent.outbox.Push(chunk.metrics()); err != nil {
+		agent.Logger.Error("Failed to spool batch to outbox", zap.Error(err))
+		return
+	}
+
+	agent.acknowledge(chunk.items)
+}
+
+// replayOutbox отправляет пакеты из очереди в порядке их добавления.
+// Останавливается на первой ошибке, неотправленные пакеты остаются в очереди.
+// Пакет, который сервер отклонил окончательно, переносится в карантин, чтобы не задерживать остальные.
+func (agent *Agent) replayOutbox(ctx context.Context) error {
+	op := "Agent.replayOutbox"
+
+	if err := agent.replay(agent.outbox, func(payload []byte) error {
+		return agent.send(ctx, payload)
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// replay отправляет функцией send пакеты очереди box, nil-очередь пуста.
+func (agent *Agent) replay(box *outbox.Outbox, send func(payload []byte) error) error {
+	if box == nil {
+		return nil
+	}
+
+	for {
+		entry, ok, err := box.Oldest()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		payload, err := json.Marshal(entry.Metrics)
+		if err != nil {
+			return err
+		}
+
+		if err := send(payload); err != nil {
+			if !rejected(err) {
+				return err
+			}
+			if err := box.Quarantine(entry.Name); err != nil {
+				return err
+			}
+			agent.Logger.Warn("Server rejected batch from outbox, moved to quarantine",
+				zap.String("entry", entry.Name),
+				zap.Int("metrics", len(entry.Metrics)),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		if err := box.Remove(entry.Name); err != nil {
+			return err
+		}
+
+		agent.Logger.Info("Replayed batch from outbox",
+			zap.String("entry", entry.Name),
+			zap.Int("metrics", len(entry.Metrics)),
+		)
+	}
+}
+
+// acknowledge удаляет из хранилища отправленные метрики и сохраняет их базовые значения relabel.
+func (agent *Agent) acknowledge(items []reportItem) {
+	for _, item := range items {
+		agent.relabel.Commit(item.baseline)
+
+		key, metric := item.key, item.stored
+		switch metric.MType {
+		case models.Gauge:
+			if cd, ok := agent.Storage.(compareDeleter); ok {
+				cd.CompareAndDelete(key, metric)
+			} else {
+				agent.Storage.Delete(key)
+			}
+		case models.Counter:
+			// Вычитаем отправленное значение: то, что накопилось во время отправки, уйдет в следующий раз
+			if metric.Delta != nil && *metric.Delta != 0 {
+				agent.Storage.Set(key, models.Metrics{
+					ID:    metric.ID,
+					MType: models.Counter,
+					Delta: lib.IntPtr(-*metric.Delta),
+				})
+			}
+		}
+	}
+}
+
+// sendTo отправляет на сервер один пакет метрик, сериализованный в JSON.
+func (agent *Agent) sendTo(ctx context.Context, t *target, payload []byte) error {
+	op := "Agent.sendTo"
+
+	endpoint := fmt.Sprintf("%s/updates", t.server)
+
+	hash := hash.GetHashHex(payload, t.hash)
 
 	var buf bytes.Buffer
 	gz := gzip.NewWriter(&buf)
 
-	_, err = gz.Write(payload)
+	_, err := gz.Write(payload)
 	if err != nil {
-		return fmt.Errorf("%s: %s", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	if err := gz.Close(); err != nil {
-		return fmt.Errorf("%s: %s", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	body := buf.Bytes()
+	if agent.encrypter != nil {
+		body, err = agent.encrypter.Encrypt(body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
 	defer cancel()
 
-	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, endpoint, &buf)
+	request, err := retryablehttp.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
 	if err != nil {
-		return fmt.Errorf("%s: %s", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	request.Close = true
 
 	request.Header.Set("Content-Encoding", "gzip")
 	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("HashSHA256", hash)
+	if agent.encrypter != nil {
+		request.Header.Set(encryption.HeaderScheme, agent.encrypter.Scheme())
+	}
+	// С подписью HMAC устаревший HashSHA256 отправляется, только если задан его ключ
+	if t.hash != "" || !agent.signer.Enabled() {
+		request.Header.Set("HashSHA256", hash)
+	}
+	if agent.signer.Enabled() {
+		agent.signer.Sign(request.Header, request.Method, request.URL.Path, payload)
+	}
+	agent.identity.SetHeaders(request.Header)
+	tokens.SetHeader(request.Header, agent.token)
+	if agent.tenant != "" {
+		request.Header.Set(tenant.Header, agent.tenant)
+	}
+	// Сервер с TRUSTED_SUBNET принимает метрики только от адресов из доверенной сети
+	if ip := t.outboundIP(); ip != "" {
+		request.Header.Set("X-Real-IP", ip)
+	}
 
-	response, err := agent.requestWithLimit(ctx, request)
+	response, err := agent.requestWithLimit(ctx, t, request)
 	if err != nil {
-		return fmt.Errorf("%s: %s", op, err)
+		t.resetOutboundIP()
+		return fmt.Errorf("%s: %w", op, err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
+		t.resetOutboundIP()
 		body, _ := io.ReadAll(response.Body)
-		response.Body.Close()
-		return fmt.Errorf("%s: bad status: %s; body: %s", op, response.Status, string(body))
-	}
-	response.Body.Close()
-
-	for _, metric := range stotageMetrics {
-		if metric.MType == models.Gauge {
-			agent.Storage.Delete(metric.ID)
-		}
+		return fmt.Errorf("%s: %w", op, &statusError{code: response.StatusCode, status: response.Status, body: string(body)})
 	}
 
 	return nil
 }
 
-func (agent *Agent) requestWithLimit(ctx context.Context, req *retryablehttp.Request) (*http.Response, error) {
+// requestWithLimit выполняет запрос с учетом ограничителя и автоматического выключателя адреса.
+// Пока выключатель открыт, запрос завершается сразу, без обращения к сети и повторов.
+func (agent *Agent) requestWithLimit(ctx context.Context, t *target, req *retryablehttp.Request) (*http.Response, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	limiter := t.currentLimiter()
+
 	select {
-	case agent.httpLimiter <- struct{}{}:
+	case limiter <- struct{}{}:
 		defer func() {
-			<-agent.httpLimiter
+			<-limiter
 		}()
-		return agent.Client.Do(req)
+
+		response, err := agent.Client.Do(req)
+		if err != nil || response.StatusCode >= http.StatusInternalServerError {
+			t.breaker.Failure()
+		} else {
+			t.breaker.Success()
+		}
+		return response, err
 	case <-ctx.Done():
+		// Запрос не был выполнен, разрешение возвращается выключателю
+		t.breaker.Release()
 		return nil, ctx.Err()
 	}
 }
@@ -1,5 +1,29 @@
 package agent
 
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/outbox"
+	"github.com/s0n1cAK/yandex-metrics/internal/relabel"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
+	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
 // До 1:1
 // httptest для client request
 // В ближайщем будущем
@@ -38,3 +62,211 @@ package agent
 // 	agent.Storage.Clear()
 // 	return nil
 // }
+
+func newTestAgent(t *testing.T, server string) *Agent {
+	t.Helper()
+
+	client := retryablehttp.NewClient()
+	client.RetryMax = 0
+	client.Logger = nil
+
+	return &Agent{
+		Storage: memstorage.New(),
+		Client:  client,
+		Server:  server,
+		Logger:  zap.NewNop(),
+		targets: []*target{newTarget(server, "", 1)},
+	}
+}
+
+func TestAgent_ReportOutbox(t *testing.T) {
+	var down atomic.Bool
+	var received atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	box, err := outbox.New(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+
+	agent := newTestAgent(t, srv.URL)
+	agent.outbox = box
+
+	down.Store(true)
+	require.NoError(t, agent.CollectIncrementCounter("PollCount", 1))
+	require.Error(t, agent.Report(context.Background()))
+
+	n, err := box.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// Отправленный в очередь счетчик больше не числится в хранилище
+	metric, ok := agent.Storage.Get("PollCount")
+	require.True(t, ok)
+	require.Equal(t, int64(0), *metric.Delta)
+
+	down.Store(false)
+	require.NoError(t, agent.CollectIncrementCounter("PollCount", 1))
+	require.NoError(t, agent.Report(context.Background()))
+	require.Equal(t, int32(2), received.Load())
+
+	n, err = box.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
+
+func TestAgent_ReportOutboxRejected(t *testing.T) {
+	var calls, received atomic.Int32
+
+	// Сервер отклоняет первый пакет при отправке и при повторе из очереди
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	box, err := outbox.New(dir, 0, 0)
+	require.NoError(t, err)
+
+	agent := newTestAgent(t, srv.URL)
+	agent.outbox = box
+
+	require.NoError(t, agent.CollectIncrementCounter("PollCount", 1))
+	require.Error(t, agent.Report(context.Background()))
+
+	// Отклоненный пакет уходит в карантин и не задерживает следующий отчет
+	require.NoError(t, agent.CollectIncrementCounter("PollCount", 1))
+	require.NoError(t, agent.Report(context.Background()))
+	require.Equal(t, int32(1), received.Load())
+
+	n, err := box.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	quarantined, err := os.ReadDir(filepath.Join(dir, outbox.QuarantineDir))
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+}
+
+func TestAgent_ReportRelabel(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err = io.ReadAll(gz)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	pipeline, err := relabel.New([]relabel.Rule{
+		{Action: relabel.ActionDrop, Name: "Lookups"},
+		{Action: relabel.ActionRename, Name: "Heap(.*)", Replacement: "heap_$1"},
+	})
+	require.NoError(t, err)
+
+	agent := newTestAgent(t, srv.URL)
+	agent.relabel = pipeline
+
+	require.NoError(t, agent.updateGaugeMetruc("Lookups", 1))
+	require.NoError(t, agent.updateGaugeMetruc("HeapAlloc", 2))
+	require.NoError(t, agent.Report(context.Background()))
+
+	var sent []models.Metrics
+	require.NoError(t, json.Unmarshal(body, &sent))
+	require.Len(t, sent, 1)
+	require.Equal(t, "heap_Alloc", sent[0].ID)
+
+	// Отброшенные и отправленные метрики удалены из хранилища
+	stored, err := agent.Storage.GetAll()
+	require.NoError(t, err)
+	require.Empty(t, stored)
+}
+
+func TestAgent_ReportGaugeToCounterRetry(t *testing.T) {
+	var down atomic.Bool
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err == nil {
+			body, _ = io.ReadAll(gz)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	pipeline, err := relabel.New([]relabel.Rule{{Action: relabel.ActionGaugeToCounter, Name: "NumGC"}})
+	require.NoError(t, err)
+
+	agent := newTestAgent(t, srv.URL)
+	agent.relabel = pipeline
+
+	// Неудачная отправка без очереди не сдвигает базовое значение
+	down.Store(true)
+	require.NoError(t, agent.updateGaugeMetruc("NumGC", 5))
+	require.Error(t, agent.Report(context.Background()))
+
+	down.Store(false)
+	require.NoError(t, agent.Report(context.Background()))
+
+	var sent []models.Metrics
+	require.NoError(t, json.Unmarshal(body, &sent))
+	require.Len(t, sent, 1)
+	require.Equal(t, int64(5), *sent[0].Delta)
+}
+
+func TestAgent_ReportSignedRetry(t *testing.T) {
+	verifier := signing.NewVerifier(signing.Keyring{"v1": "secret"}, time.Minute)
+	var attempts atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+
+		if err := verifier.Verify(r.Header, r.Method, r.URL.Path, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Первая попытка принята, но ответ потерян - повтор должен пройти проверку nonce
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cfg := config.Default(zap.NewNop())
+	require.NoError(t, cfg.Endpoints.Set(srv.URL))
+	cfg.AgentIDFile = ""
+	cfg.SignKeyID = "v1"
+	cfg.SignKey = "secret"
+	cfg.Client.RetryWaitMin = time.Millisecond
+	cfg.Client.RetryWaitMax = time.Millisecond
+	cfg.Client.Logger = nil
+
+	agent, err := NewFromConfig(cfg, memstorage.New())
+	require.NoError(t, err)
+
+	require.NoError(t, agent.updateCounterMetruc("PollCount", 1))
+	require.NoError(t, agent.Report(context.Background()))
+	require.Equal(t, int32(2), attempts.Load())
+}
@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// SelfMetricPrefix - зарезервированный префикс метрик самого агента.
+// Метрики StatsD с этим префиксом отбрасываются.
+const SelfMetricPrefix = "agent_"
+
+// selfMetrics - счетчики работы агента. Значения накопительные и отправляются как gauge,
+// чтобы повторная отправка из очереди не искажала их на сервере.
+type selfMetrics struct {
+	reportSuccess atomic.Int64
+	reportFailure atomic.Int64
+	reportLatency atomic.Int64
+	payloadBytes  atomic.Int64
+	payloadTotal  atomic.Int64
+	retries       atomic.Int64
+	dropped       atomic.Int64
+
+	mu         sync.Mutex
+	collectors map[string]*collectorStats
+}
+
+type collectorStats struct {
+	duration time.Duration
+	errors   int64
+}
+
+func (s *selfMetrics) observeReport(latency time.Duration, payload int, err error) {
+	s.reportLatency.Store(int64(latency))
+	s.payloadBytes.Store(int64(payload))
+	s.payloadTotal.Add(int64(payload))
+
+	if err != nil {
+		s.reportFailure.Add(1)
+	} else {
+		s.reportSuccess.Add(1)
+	}
+}
+
+func (s *selfMetrics) observeCollector(name string, duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.collectors == nil {
+		s.collectors = make(map[string]*collectorStats)
+	}
+
+	stats, ok := s.collectors[name]
+	if !ok {
+		stats = &collectorStats{}
+		s.collectors[name] = stats
+	}
+
+	stats.duration = duration
+	if err != nil {
+		stats.errors++
+	}
+}
+
+// selfSnapshot возвращает текущие значения метрик агента.
+func (agent *Agent) selfSnapshot() []models.Metrics {
+	s := &agent.self
+
+	dropped := s.dropped.Load()
+	if agent.statsd != nil {
+		dropped += agent.statsd.Dropped()
+	}
+
+	values := map[string]float64{
+		"report_success_total":  float64(s.reportSuccess.Load()),
+		"report_failure_total":  float64(s.reportFailure.Load()),
+		"report_latency_ms":     float64(time.Duration(s.reportLatency.Load()).Milliseconds()),
+		"payload_bytes":         float64(s.payloadBytes.Load()),
+		"payload_bytes_total":   float64(s.payloadTotal.Load()),
+		"retries_total":         float64(s.retries.Load()),
+		"dropped_samples_total": float64(dropped),
+	}
+
+	if stored, err := agent.Storage.GetAll(); err == nil {
+		values["storage_size"] = float64(len(stored))
+	}
+
+	if agent.outbox != nil {
+		if n, err := agent.outbox.Len(); err == nil {
+			values["outbox_size"] = float64(n)
+		}
+		values["outbox_dropped_total"] = float64(agent.outbox.Dropped())
+	}
+
+	for _, t := range agent.targets {
+		suffix := metricSuffix(t.server)
+		values["breaker_state_"+suffix] = float64(t.breaker.State())
+		values["breaker_opens_total_"+suffix] = float64(t.breaker.Opens())
+	}
+
+	s.mu.Lock()
+	for name, stats := range s.collectors {
+		values["collector_duration_ms_"+name] = float64(stats.duration.Microseconds()) / 1000
+		values["collector_errors_total_"+name] = float64(stats.errors)
+	}
+	s.mu.Unlock()
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]models.Metrics, 0, len(values))
+	for _, name := range names {
+		result = append(result, models.Metrics{
+			ID:    SelfMetricPrefix + name,
+			MType: models.Gauge,
+			Value: lib.FloatPtr(values[name]),
+		})
+	}
+
+	return result
+}
+
+// CollectSelf добавляет метрики агента в текущее окно отчета.
+// Состояние выключателей кодируется так: 0 - closed, 1 - half-open, 2 - open.
+func (agent *Agent) CollectSelf() error {
+	for _, metric := range agent.selfSnapshot() {
+		if err := agent.updateGaugeMetruc(metric.ID, *metric.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isSelfMetric(name string) bool {
+	return strings.HasPrefix(name, SelfMetricPrefix)
+}
+
+// serveSelfMetrics отдает метрики агента в JSON на локальном адресе для отладки.
+func (agent *Agent) serveSelfMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(agent.selfSnapshot())
+	})
+
+	srv := &http.Server{
+		Addr:              agent.selfMetricsAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	agent.Logger.Info("Self metrics endpoint started", zap.String("address", agent.selfMetricsAddress))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		agent.Logger.Error("Self metrics endpoint error:", zap.Error(err))
+	}
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/statsd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_SelfMetrics(t *testing.T) {
+	srv := newTestServer(t)
+	agent := newTestAgent(t, srv.URL)
+	agent.statsd = statsd.NewAggregator()
+
+	ctx := context.Background()
+
+	agent.poll()
+	require.NoError(t, agent.Report(ctx))
+
+	srv.down.Store(true)
+	require.NoError(t, agent.CollectIncrementCounter("PollCount", 1))
+	require.Error(t, agent.Report(ctx))
+
+	// Значения с зарезервированным префиксом не принимаются из StatsD
+	agent.statsd.Add(statsd.Sample{Name: "agent_report_success_total", Type: statsd.TypeGauge, Value: 100})
+	require.NoError(t, agent.CollectStatsD())
+
+	values := make(map[string]float64)
+	for _, metric := range agent.selfSnapshot() {
+		values[metric.ID] = *metric.Value
+	}
+
+	require.Equal(t, float64(1), values["agent_report_success_total"])
+	require.Equal(t, float64(1), values["agent_report_failure_total"])
+	require.Equal(t, float64(1), values["agent_dropped_samples_total"])
+	require.Positive(t, values["agent_payload_bytes_total"])
+	require.Equal(t, float64(0), values["agent_collector_errors_total_runtime"])
+	require.Contains(t, values, "agent_storage_size")
+}
@@ -0,0 +1,352 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/breaker"
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/outbox"
+	"go.uber.org/zap"
+)
+
+const probeTimeout = 2 * time.Second
+
+// targetOutboxDir - подкаталог OutboxDir с очередями адресов для рассылки fanout
+const targetOutboxDir = "targets"
+
+// targetPendingLimit - сколько недоставленных пакетов fanout адрес хранит в памяти, лишние вытесняют самые старые
+const targetPendingLimit = 100
+
+// target - адрес сервера со своим ключом подписи, ограничителем запросов и автоматическим выключателем
+type target struct {
+	server  string
+	hash    string
+	breaker *breaker.Breaker
+	// limiter ограничивает число одновременных запросов, заменяется при смене RateLimit
+	mu       sync.Mutex
+	limiter  chan struct{}
+	failures atomic.Int32
+	// outbox - очередь пакетов, не доставленных на этот адрес при рассылке fanout, nil без очереди
+	outbox *outbox.Outbox
+	// queueMu защищает pending и не дает двум отправкам дослать одну запись очереди дважды
+	queueMu sync.Mutex
+	// pending - пакеты fanout, не доставленные на этот адрес и не сохраненные в outbox
+	pending [][]byte
+	// ip - найденный outboundIP, сбрасывается при ошибке отправки
+	ip atomic.Pointer[string]
+}
+
+func newTarget(server, hash string, rateLimit int) *target {
+	return &target{
+		server:  server,
+		hash:    hash,
+		limiter: make(chan struct{}, rateLimit),
+		breaker: breaker.New(config.DefaultBreakerErrors, config.DefaultBreakerCoolDown.Duration(), config.DefaultBreakerHalfOpen),
+	}
+}
+
+// currentLimiter возвращает действующий ограничитель.
+// Запрос освобождает место в том же ограничителе, который занял.
+func (t *target) currentLimiter() chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limiter
+}
+
+func (t *target) setRateLimit(rateLimit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cap(t.limiter) != rateLimit {
+		t.limiter = make(chan struct{}, rateLimit)
+	}
+}
+
+// newTargetOutboxes создает очереди адресов для рассылки fanout в подкаталогах OutboxDir.
+func newTargetOutboxes(cfg config.Config, targets []*target) error {
+	if cfg.Strategy != config.StrategyFanout || cfg.OutboxDir == "" {
+		return nil
+	}
+
+	for _, t := range targets {
+		box, err := outbox.New(filepath.Join(cfg.OutboxDir, targetOutboxDir, metricSuffix(t.server)), cfg.OutboxMaxSize, cfg.OutboxMaxAge.Duration())
+		if err != nil {
+			return err
+		}
+		t.outbox = box
+	}
+	return nil
+}
+
+func newTargets(cfg config.Config) []*target {
+	targets := make([]*target, 0, len(cfg.Endpoints))
+	for i, endpoint := range cfg.Endpoints {
+		hash := cfg.Hash
+		if i < len(cfg.EndpointKeys) && cfg.EndpointKeys[i] != "" {
+			hash = cfg.EndpointKeys[i]
+		}
+		t := newTarget(endpoint.String(), hash, cfg.RateLimit)
+		t.breaker = breaker.New(cfg.BreakerErrors, cfg.BreakerCoolDown.Duration(), cfg.BreakerHalfOpen)
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// send отправляет пакет согласно выбранной стратегии.
+func (agent *Agent) send(ctx context.Context, payload []byte) error {
+	op := "Agent.send"
+
+	if agent.strategy == config.StrategyFanout {
+		agent.sendFanout(ctx, payload)
+		return nil
+	}
+	if err := agent.sendFailover(ctx, payload); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// sendFailover отправляет пакет на активный адрес.
+// После failoverThreshold ошибок подряд активным становится следующий адрес.
+func (agent *Agent) sendFailover(ctx context.Context, payload []byte) error {
+	idx := int(agent.active.Load())
+	t := agent.targets[idx]
+
+	err := agent.sendTo(ctx, t, payload)
+	if err == nil {
+		t.failures.Store(0)
+		return nil
+	}
+
+	if len(agent.targets) > 1 && int(t.failures.Add(1)) >= agent.failoverThreshold {
+		next := (idx + 1) % len(agent.targets)
+		if agent.active.CompareAndSwap(int32(idx), int32(next)) {
+			t.failures.Store(0)
+			agent.Logger.Warn("Switching to next server",
+				zap.String("from", t.server),
+				zap.String("to", agent.targets[next].server),
+			)
+		}
+	}
+
+	return fmt.Errorf("%s: %w", t.server, err)
+}
+
+// sendFanout отправляет пакет на все адреса одновременно.
+// Доставка учитывается для каждого адреса отдельно: пакет, не доставленный на адрес, попадает в очередь
+// этого адреса и досылается только ему. Поэтому пакет fanout никогда не возвращается в хранилище
+// или в общую очередь: повторная рассылка задвоила бы счетчики на уже принявших его серверах.
+func (agent *Agent) sendFanout(ctx context.Context, payload []byte) {
+	var wg sync.WaitGroup
+	for _, t := range agent.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent.fanoutTo(ctx, t, payload)
+		}()
+	}
+	wg.Wait()
+}
+
+// fanoutTo досылает на адрес t его очереди и отправляет пакет, неотправленный пакет ставится в очередь адреса.
+func (agent *Agent) fanoutTo(ctx context.Context, t *target, payload []byte) {
+	sendTo := func(payload []byte) error {
+		return agent.sendTo(ctx, t, payload)
+	}
+
+	// Пакеты из очередей отправляются раньше текущего, чтобы сохранить порядок
+	t.queueMu.Lock()
+	err := agent.replay(t.outbox, sendTo)
+	if err == nil {
+		err = agent.replayPending(t, sendTo)
+	}
+	t.queueMu.Unlock()
+
+	if err == nil {
+		if err = sendTo(payload); err == nil {
+			return
+		}
+	}
+	agent.enqueue(t, payload, err)
+}
+
+// enqueue сохраняет пакет, не доставленный на адрес t из-за cause, в очередь адреса на диске.
+// Без очереди или при ошибке записи пакет остается в памяти до следующей отправки.
+func (agent *Agent) enqueue(t *target, payload []byte, cause error) {
+	if t.outbox != nil {
+		err := t.outbox.PushJSON(payload)
+		if err == nil {
+			agent.Logger.Warn("Fanout to server failed, batch spooled",
+				zap.String("server", t.server),
+				zap.Error(cause),
+			)
+			return
+		}
+		agent.Logger.Error("Failed to spool fanout batch, keeping it in memory",
+			zap.String("server", t.server),
+			zap.Error(err),
+		)
+	}
+
+	t.queueMu.Lock()
+	defer t.queueMu.Unlock()
+
+	if len(t.pending) >= targetPendingLimit {
+		t.pending = t.pending[1:]
+		agent.Logger.Error("Fanout queue is full, oldest batch dropped", zap.String("server", t.server))
+	}
+	t.pending = append(t.pending, payload)
+	agent.Logger.Warn("Fanout to server failed, batch queued in memory",
+		zap.String("server", t.server),
+		zap.Int("pending", len(t.pending)),
+		zap.Error(cause),
+	)
+}
+
+// replayPending досылает на адрес t пакеты из памяти, вызывается под t.queueMu.
+// Пакет, который сервер отклонил окончательно, отбрасывается, чтобы не задерживать остальные.
+func (agent *Agent) replayPending(t *target, send func(payload []byte) error) error {
+	for len(t.pending) > 0 {
+		if err := send(t.pending[0]); err != nil {
+			if !rejected(err) {
+				return err
+			}
+			agent.Logger.Warn("Server rejected queued fanout batch, dropped",
+				zap.String("server", t.server),
+				zap.Error(err),
+			)
+		}
+		t.pending = t.pending[1:]
+	}
+	return nil
+}
+
+// probeTargets периодически проверяет адреса с более высоким приоритетом, чем активный,
+// и возвращается на первый доступный из них.
+func (agent *Agent) probeTargets(ctx context.Context) {
+	ticker := time.NewTicker(agent.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			active := int(agent.active.Load())
+			for i := 0; i < active; i++ {
+				if err := agent.probe(ctx, agent.targets[i]); err != nil {
+					agent.Logger.Debug("Server is still unavailable", zap.String("server", agent.targets[i].server), zap.Error(err))
+					continue
+				}
+
+				if agent.active.CompareAndSwap(int32(active), int32(i)) {
+					agent.targets[i].failures.Store(0)
+					agent.Logger.Info("Switching back to server", zap.String("server", agent.targets[i].server))
+				}
+				break
+			}
+		}
+	}
+}
+
+// probe проверяет доступность сервера через /ping без повторов.
+// Сервер считается доступным, если он ответил, даже если недоступна его база данных.
+func (agent *Agent) probe(ctx context.Context, t *target) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, t.server+"/ping", nil)
+	if err != nil {
+		return err
+	}
+	agent.identity.SetHeaders(request.Header)
+
+	client := http.DefaultClient
+	if agent.Client != nil && agent.Client.HTTPClient != nil {
+		client = agent.Client.HTTPClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return errors.New(response.Status)
+	}
+	return nil
+}
+
+// metricSuffix превращает адрес сервера в часть имени метрики.
+func metricSuffix(server string) string {
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		server = u.Host
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, server)
+}
+
+// outboundIP возвращает адрес интерфейса, через который агент обращается к серверу.
+// Адрес определяется один раз и запоминается до resetOutboundIP. При ошибке возвращает пустую строку.
+func (t *target) outboundIP() string {
+	if ip := t.ip.Load(); ip != nil {
+		return *ip
+	}
+
+	ip := resolveOutboundIP(t.server)
+	if ip != "" {
+		t.ip.Store(&ip)
+	}
+	return ip
+}
+
+// resetOutboundIP забывает найденный адрес: после ошибки отправки маршрут мог измениться.
+func (t *target) resetOutboundIP() {
+	t.ip.Store(nil)
+}
+
+// resolveOutboundIP выбирает маршрут до server через соединение UDP, которое не отправляет пакетов.
+func resolveOutboundIP(server string) string {
+	u, err := url.Parse(server)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return ""
+	}
+	return addr.IP.String()
+}
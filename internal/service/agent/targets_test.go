@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/breaker"
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/outbox"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	*httptest.Server
+	down     atomic.Bool
+	received atomic.Int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ts := &testServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ts.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/updates" {
+			ts.received.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestAgent_Failover(t *testing.T) {
+	primary, secondary := newTestServer(t), newTestServer(t)
+
+	agent := newTestAgent(t, primary.URL)
+	agent.targets = []*target{newTarget(primary.URL, "", 1), newTarget(secondary.URL, "", 1)}
+	agent.strategy = config.StrategyFailover
+	agent.failoverThreshold = 2
+
+	ctx := context.Background()
+	payload := []byte(`[]`)
+
+	primary.down.Store(true)
+	require.Error(t, agent.send(ctx, payload))
+	require.Equal(t, int32(0), agent.active.Load())
+	require.Error(t, agent.send(ctx, payload))
+	require.Equal(t, int32(1), agent.active.Load())
+
+	require.NoError(t, agent.send(ctx, payload))
+	require.Equal(t, int32(1), secondary.received.Load())
+
+	// Основной сервер снова доступен, проверка возвращает его
+	primary.down.Store(false)
+	require.NoError(t, agent.probe(ctx, agent.targets[0]))
+}
+
+func TestAgent_Fanout(t *testing.T) {
+	primary, secondary := newTestServer(t), newTestServer(t)
+
+	agent := newTestAgent(t, primary.URL)
+	agent.targets = []*target{newTarget(primary.URL, "", 1), newTarget(secondary.URL, "", 1)}
+	agent.strategy = config.StrategyFanout
+
+	ctx := context.Background()
+	payload := []byte(`[]`)
+
+	require.NoError(t, agent.send(ctx, payload))
+	require.Equal(t, int32(1), primary.received.Load())
+	require.Equal(t, int32(1), secondary.received.Load())
+
+	// Без очереди на диске пакет для недоступного сервера ждет в памяти, отправка не считается ошибкой:
+	// иначе пакет остался бы в хранилище и повторно ушел бы и на принявший его сервер
+	secondary.down.Store(true)
+	require.NoError(t, agent.send(ctx, payload))
+	require.Equal(t, int32(2), primary.received.Load())
+	require.Len(t, agent.targets[1].pending, 1)
+
+	// Очередь досылается только своему серверу
+	secondary.down.Store(false)
+	require.NoError(t, agent.send(ctx, payload))
+	require.Equal(t, int32(3), primary.received.Load())
+	require.Equal(t, int32(3), secondary.received.Load())
+	require.Empty(t, agent.targets[1].pending)
+
+	// Очередь в памяти ограничена
+	secondary.down.Store(true)
+	for range targetPendingLimit + 1 {
+		require.NoError(t, agent.send(ctx, payload))
+	}
+	require.Len(t, agent.targets[1].pending, targetPendingLimit)
+}
+
+func TestAgent_FanoutSpool(t *testing.T) {
+	primary, secondary := newTestServer(t), newTestServer(t)
+
+	cfg := config.Config{
+		Strategy:  config.StrategyFanout,
+		OutboxDir: t.TempDir(),
+	}
+	agent := newTestAgent(t, primary.URL)
+	agent.targets = []*target{newTarget(primary.URL, "", 1), newTarget(secondary.URL, "", 1)}
+	agent.strategy = config.StrategyFanout
+	require.NoError(t, newTargetOutboxes(cfg, agent.targets))
+
+	ctx := context.Background()
+	payload := []byte(`[]`)
+
+	// Пакет для недоступного сервера сохраняется в его очередь
+	secondary.down.Store(true)
+	require.NoError(t, agent.send(ctx, payload))
+	n, err := agent.targets[1].outbox.Len()
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// Очередь досылается только своему серверу, основной получает только новый пакет
+	secondary.down.Store(false)
+	require.NoError(t, agent.send(ctx, payload))
+	require.Equal(t, int32(2), primary.received.Load())
+	require.Equal(t, int32(2), secondary.received.Load())
+
+	n, err = agent.targets[1].outbox.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	// Пакет, который не удалось записать в очередь, остается в памяти адреса, а не в общей очереди
+	agent.targets[1].outbox, err = outbox.New(t.TempDir(), 1, 0)
+	require.NoError(t, err)
+	secondary.down.Store(true)
+	require.NoError(t, agent.send(ctx, payload))
+	require.Len(t, agent.targets[1].pending, 1)
+}
+
+func TestAgent_BreakerSkipsRequests(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+	agent.targets[0].breaker = breaker.New(1, time.Minute, 1)
+
+	ctx := context.Background()
+	require.Error(t, agent.send(ctx, []byte(`[]`)))
+	require.ErrorIs(t, agent.send(ctx, []byte(`[]`)), breaker.ErrOpen)
+	require.Equal(t, int32(1), requests.Load())
+
+	agent.gauges = newGaugeAggregator(config.DefaultAggregation)
+	require.NoError(t, agent.CollectSelf())
+	require.NoError(t, agent.flushGauges())
+
+	metric, ok := agent.Storage.Get(SelfMetricPrefix + "breaker_state_" + metricSuffix(srv.URL))
+	require.True(t, ok)
+	require.Equal(t, float64(breaker.Open), *metric.Value)
+}
+
+func TestTarget_OutboundIP(t *testing.T) {
+	target := newTarget("http://127.0.0.1:8080", "", 1)
+	require.Equal(t, "127.0.0.1", target.outboundIP())
+	require.NotNil(t, target.ip.Load())
+
+	// Адрес запоминается и определяется заново только после сброса
+	other := "192.0.2.1"
+	target.ip.Store(&other)
+	require.Equal(t, other, target.outboundIP())
+	target.resetOutboundIP()
+	require.Equal(t, "127.0.0.1", target.outboundIP())
+
+	require.Empty(t, newTarget("http://", "", 1).outboundIP())
+}
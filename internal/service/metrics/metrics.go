@@ -1,9 +1,10 @@
 package metrics
 
 import (
+	"cmp"
 	"context"
 	"errors"
-	"time"
+	"slices"
 
 	"go.uber.org/zap"
 
@@ -12,6 +13,9 @@ import (
 	models "github.com/s0n1cAK/yandex-metrics/internal/model"
 )
 
+// EventQuotaExceeded - событие аудита о записи, отклоненной квотой числа метрик
+const EventQuotaExceeded = "quota_exceeded"
+
 // Repository интерфейс определяет контракт для хранилища метрик.
 type Repository interface {
 	// Set устанавливает значение метрики с указанным идентификатором
@@ -24,6 +28,16 @@ type Repository interface {
 	SetAll(batch []models.Metrics) error
 }
 
+// TenantRepository - хранилище, разделяющее метрики арендаторов.
+// Если репозиторий сервиса его реализует, сервис работает с метриками арендатора из контекста запроса.
+type TenantRepository interface {
+	Repository
+	// ForContext возвращает метрики арендатора запроса ctx с квотами его клиента
+	ForContext(ctx context.Context) Repository
+	// GetAllTenants возвращает метрики всех арендаторов
+	GetAllTenants() ([]models.Metrics, error)
+}
+
 // Pinger интерфейс определяет контракт для проверки подключения к базе данных.
 type Pinger interface {
 	// Ping проверяет доступность базы данных
@@ -40,6 +54,8 @@ type Service interface {
 	Get(ctx context.Context, id, mtype string) (models.Metrics, error)
 	// ListIDs возвращает список всех идентификаторов метрик
 	ListIDs(ctx context.Context) ([]string, error)
+	// ListAll возвращает метрики всех арендаторов
+	ListAll(ctx context.Context) ([]models.Metrics, error)
 	// Ping проверяет доступность базы данных
 	Ping(ctx context.Context) error
 }
@@ -48,11 +64,11 @@ type service struct {
 	repo      Repository
 	ping      Pinger
 	log       *zap.Logger
-	publisher audit.AuditPublisher
+	publisher *audit.AuditPublisher
 }
 
 // New создает новый экземпляр сервиса метрик с заданными зависимостями.
-func New(repo Repository, ping Pinger, log *zap.Logger, publisher audit.AuditPublisher) Service {
+func New(repo Repository, ping Pinger, log *zap.Logger, publisher *audit.AuditPublisher) Service {
 	return &service{repo: repo, ping: ping, log: log, publisher: publisher}
 }
 
@@ -73,12 +89,13 @@ func (s *service) Set(ctx context.Context, m models.Metrics, ip string) error {
 		return domain.ErrInvalidType
 	}
 
-	if err := s.repo.Set(m.ID, m); err != nil {
+	if err := s.repoFor(ctx).Set(m.ID, m); err != nil {
 		s.log.Error(err.Error())
+		s.reject(ctx, []models.Metrics{m}, ip, err)
 		return err
 	}
 
-	s.notify([]models.Metrics{m}, ip)
+	s.notify(ctx, []models.Metrics{m}, ip)
 	s.log.Info("metric set", zap.String("id", m.ID), zap.String("type", m.MType))
 	return nil
 }
@@ -105,15 +122,20 @@ func (s *service) SetBatch(ctx context.Context, batch []models.Metrics, ip strin
 		}
 	}
 
-	s.notify(batch, ip)
-	return s.repo.SetAll(batch)
+	if err := s.repoFor(ctx).SetAll(batch); err != nil {
+		s.reject(ctx, batch, ip, err)
+		return err
+	}
+
+	s.notify(ctx, batch, ip)
+	return nil
 }
 
 func (s *service) Get(ctx context.Context, id, mtype string) (models.Metrics, error) {
 	if id == "" || mtype == "" {
 		return models.Metrics{}, domain.ErrInvalidPayload
 	}
-	v, ok := s.repo.Get(id)
+	v, ok := s.repoFor(ctx).Get(id)
 	if !ok {
 		return models.Metrics{}, domain.ErrNotFound
 	}
@@ -124,7 +146,7 @@ func (s *service) Get(ctx context.Context, id, mtype string) (models.Metrics, er
 }
 
 func (s *service) ListIDs(ctx context.Context) ([]string, error) {
-	items, err := s.repo.GetAll()
+	items, err := s.repoFor(ctx).GetAll()
 	if err != nil {
 		return nil, err
 	}
@@ -135,6 +157,41 @@ func (s *service) ListIDs(ctx context.Context) ([]string, error) {
 	return ids, nil
 }
 
+func (s *service) ListAll(ctx context.Context) ([]models.Metrics, error) {
+	var (
+		items []models.Metrics
+		err   error
+	)
+
+	if tr, ok := s.repo.(TenantRepository); ok {
+		items, err = tr.GetAllTenants()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		all, err := s.repo.GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range all {
+			items = append(items, m)
+		}
+	}
+
+	slices.SortFunc(items, func(a, b models.Metrics) int {
+		return cmp.Or(cmp.Compare(a.Tenant, b.Tenant), cmp.Compare(a.ID, b.ID))
+	})
+	return items, nil
+}
+
+// repoFor возвращает метрики арендатора запроса.
+func (s *service) repoFor(ctx context.Context) Repository {
+	if tr, ok := s.repo.(TenantRepository); ok {
+		return tr.ForContext(ctx)
+	}
+	return s.repo
+}
+
 func (s *service) Ping(ctx context.Context) error {
 	if s.ping == nil {
 		return errors.New("no pinger configured")
@@ -142,13 +199,26 @@ func (s *service) Ping(ctx context.Context) error {
 	return s.ping.Ping(ctx)
 }
 
-func (s *service) notify(metrics []models.Metrics, ip string) {
-	err := s.publisher.Publish(models.AuditEvent{
-		TS:        time.Now().Unix(),
-		Metrics:   metrics,
-		IPAddress: ip,
-	})
-	if err != nil {
+func (s *service) notify(ctx context.Context, metrics []models.Metrics, ip string) {
+	event := audit.NewEvent(ctx, ip)
+	event.Metrics = metrics
+	s.publish(event)
+}
+
+// reject сообщает в аудит о записи metrics, отклоненной квотой. Остальные ошибки записи в аудит не попадают.
+func (s *service) reject(ctx context.Context, metrics []models.Metrics, ip string, err error) {
+	if !errors.Is(err, domain.ErrQuotaExceeded) {
+		return
+	}
+	event := audit.NewEvent(ctx, ip)
+	event.Event = EventQuotaExceeded
+	event.Metrics = metrics
+	event.Reason = err.Error()
+	s.publish(event)
+}
+
+func (s *service) publish(event models.AuditEvent) {
+	if err := s.publisher.Publish(event); err != nil {
 		s.log.Error(err.Error())
 	}
 }
@@ -20,7 +20,7 @@ func BenchmarkServiceSet(b *testing.B) {
 	logger, _ := zap.NewProduction()
 	repo := memstorage.New()
 	publisher := &audit.AuditPublisher{}
-	service := New(repo, &mockPinger{}, logger, *publisher)
+	service := New(repo, &mockPinger{}, logger, publisher)
 
 	ctx := context.Background()
 	metric := models.Metrics{
@@ -39,7 +39,7 @@ func BenchmarkServiceSetBatch(b *testing.B) {
 	logger, _ := zap.NewProduction()
 	repo := memstorage.New()
 	publisher := &audit.AuditPublisher{}
-	service := New(repo, &mockPinger{}, logger, *publisher)
+	service := New(repo, &mockPinger{}, logger, publisher)
 
 	ctx := context.Background()
 	batch := make([]models.Metrics, 100)
@@ -62,7 +62,7 @@ func BenchmarkServiceGet(b *testing.B) {
 	logger, _ := zap.NewProduction()
 	repo := memstorage.New()
 	publisher := &audit.AuditPublisher{}
-	service := New(repo, &mockPinger{}, logger, *publisher)
+	service := New(repo, &mockPinger{}, logger, publisher)
 
 	ctx := context.Background()
 	metric := models.Metrics{
@@ -82,7 +82,7 @@ func BenchmarkServiceListIDs(b *testing.B) {
 	logger, _ := zap.NewProduction()
 	repo := memstorage.New()
 	publisher := &audit.AuditPublisher{}
-	service := New(repo, &mockPinger{}, logger, *publisher)
+	service := New(repo, &mockPinger{}, logger, publisher)
 
 	ctx := context.Background()
 	for i := 0; i < 1000; i++ {
@@ -0,0 +1,230 @@
+// Package signing подписывает запросы HMAC-SHA256 и проверяет подписи на сервере.
+//
+// Подписывается строка из метода, пути, времени, одноразового значения и SHA-256 тела запроса.
+// Тело подписывается до сжатия. Время и одноразовое значение защищают от повторной отправки
+// перехваченного запроса, идентификатор ключа позволяет менять ключи без остановки агентов.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Заголовки подписи
+const (
+	HeaderKeyID     = "X-Signature-Key-ID"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+	HeaderDigest    = "X-Content-SHA256"
+	HeaderSignature = "X-Signature"
+)
+
+// DefaultSkew - допустимое расхождение часов агента и сервера
+var DefaultSkew = 5 * time.Minute
+
+var (
+	ErrUnsigned     = errors.New("request is not signed")
+	ErrUnknownKey   = errors.New("unknown signing key id")
+	ErrBadSignature = errors.New("signature mismatch")
+	ErrBadDigest    = errors.New("body digest mismatch")
+	ErrExpired      = errors.New("signature timestamp outside allowed skew")
+	ErrReplay       = errors.New("signature nonce already used")
+	ErrBadKeyring   = errors.New("keyring must be comma-separated id:key pairs")
+)
+
+// Signed сообщает, есть ли в заголовках подпись HMAC.
+func Signed(h http.Header) bool {
+	return h.Get(HeaderSignature) != ""
+}
+
+// Digest возвращает SHA-256 тела в hex.
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// compute возвращает HMAC-SHA256 строки подписи в hex.
+func compute(key, method, path, timestamp, nonce, digest string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strings.Join([]string{method, path, timestamp, nonce, digest}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signer подписывает запросы ключом KeyID.
+type Signer struct {
+	KeyID string
+	Key   string
+}
+
+// Enabled сообщает, задан ли ключ подписи.
+func (s Signer) Enabled() bool {
+	return s.Key != ""
+}
+
+// Sign добавляет в h подпись запроса с телом body.
+func (s Signer) Sign(h http.Header, method, path string, body []byte) {
+	h.Set(HeaderDigest, Digest(body))
+	s.Resign(h, method, path)
+}
+
+// Resign обновляет время, одноразовое значение и подпись, сохраняя хеш тела из h.
+// Используется перед повтором запроса, который сервер иначе отклонит как повторный.
+func (s Signer) Resign(h http.Header, method, path string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := newNonce()
+
+	h.Set(HeaderKeyID, s.KeyID)
+	h.Set(HeaderTimestamp, timestamp)
+	h.Set(HeaderNonce, nonce)
+	h.Set(HeaderSignature, compute(s.Key, method, path, timestamp, nonce, h.Get(HeaderDigest)))
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Keyring - действующие ключи сервера по идентификатору.
+// Формат строки: id1:key1,id2:key2. Реализует flag.Value и encoding.TextUnmarshaler.
+type Keyring map[string]string
+
+func (k *Keyring) String() string {
+	ids := make([]string, 0, len(*k))
+	for id := range *k {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	// Ключи не выводятся, чтобы не попасть в логи и справку
+	return strings.Join(ids, ",")
+}
+
+func (k *Keyring) Type() string {
+	return "keyring"
+}
+
+func (k *Keyring) Set(value string) error {
+	keys := make(Keyring)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || key == "" {
+			return fmt.Errorf("%w: %q", ErrBadKeyring, pair)
+		}
+		keys[id] = key
+	}
+	*k = keys
+	return nil
+}
+
+func (k *Keyring) UnmarshalText(text []byte) error {
+	return k.Set(string(text))
+}
+
+// Verifier проверяет подписи запросов и запоминает использованные одноразовые значения.
+type Verifier struct {
+	keys Keyring
+	skew time.Duration
+	now  func() time.Time
+
+	mu sync.Mutex
+	// nonces хранит одноразовые значения до истечения окна, в котором запрос еще может быть принят
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewVerifier создает проверку подписей ключами keys с допустимым расхождением часов skew.
+func NewVerifier(keys Keyring, skew time.Duration) *Verifier {
+	if skew <= 0 {
+		skew = DefaultSkew
+	}
+	return &Verifier{
+		keys:   keys,
+		skew:   skew,
+		now:    time.Now,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// Check проверяет подпись и хеш тела без проверки времени и nonce.
+// Подходит для ответов сервера, которые клиент проверяет сразу после получения.
+func Check(keys Keyring, h http.Header, method, path string, body []byte) error {
+	signature := h.Get(HeaderSignature)
+	if signature == "" {
+		return ErrUnsigned
+	}
+
+	key, ok := keys[h.Get(HeaderKeyID)]
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	digest := h.Get(HeaderDigest)
+
+	expected := compute(key, method, path, h.Get(HeaderTimestamp), h.Get(HeaderNonce), digest)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrBadSignature
+	}
+
+	if !hmac.Equal([]byte(digest), []byte(Digest(body))) {
+		return ErrBadDigest
+	}
+
+	return nil
+}
+
+// Verify проверяет подпись запроса с телом body, время подписи и однократность nonce.
+func (v *Verifier) Verify(h http.Header, method, path string, body []byte) error {
+	if err := Check(v.keys, h, method, path, body); err != nil {
+		return err
+	}
+
+	timestamp := h.Get(HeaderTimestamp)
+	nonce := h.Get(HeaderNonce)
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrExpired
+	}
+	now := v.now()
+	signedAt := time.Unix(unix, 0)
+	if signedAt.Before(now.Add(-v.skew)) || signedAt.After(now.Add(v.skew)) {
+		return ErrExpired
+	}
+
+	return v.useNonce(nonce, signedAt.Add(v.skew), now)
+}
+
+// useNonce запоминает nonce до expires. Позже запрос с ним отклоняется по времени.
+func (v *Verifier) useNonce(nonce string, expires, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if now.Sub(v.lastPrune) > v.skew {
+		for n, exp := range v.nonces {
+			if exp.Before(now) {
+				delete(v.nonces, n)
+			}
+		}
+		v.lastPrune = now
+	}
+
+	if _, used := v.nonces[nonce]; used {
+		return ErrReplay
+	}
+	v.nonces[nonce] = expires
+	return nil
+}
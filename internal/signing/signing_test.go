@@ -0,0 +1,80 @@
+package signing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":5}]`)
+	signer := Signer{KeyID: "v2", Key: "new-secret"}
+
+	var keys Keyring
+	require.NoError(t, keys.Set("v1:old-secret,v2:new-secret"))
+
+	t.Run("valid", func(t *testing.T) {
+		v := NewVerifier(keys, time.Minute)
+		h := http.Header{}
+		signer.Sign(h, http.MethodPost, "/updates", body)
+		require.NoError(t, v.Verify(h, http.MethodPost, "/updates", body))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		v := NewVerifier(keys, time.Minute)
+		h := http.Header{}
+		signer.Sign(h, http.MethodPost, "/updates", body)
+		require.NoError(t, v.Verify(h, http.MethodPost, "/updates", body))
+		require.ErrorIs(t, v.Verify(h, http.MethodPost, "/updates", body), ErrReplay)
+
+		// Повтор с новой подписью принимается
+		signer.Resign(h, http.MethodPost, "/updates")
+		require.NoError(t, v.Verify(h, http.MethodPost, "/updates", body))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		v := NewVerifier(keys, time.Minute)
+		v.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		h := http.Header{}
+		signer.Sign(h, http.MethodPost, "/updates", body)
+		require.ErrorIs(t, v.Verify(h, http.MethodPost, "/updates", body), ErrExpired)
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		v := NewVerifier(keys, time.Minute)
+		h := http.Header{}
+		signer.Sign(h, http.MethodPost, "/updates", body)
+		require.ErrorIs(t, v.Verify(h, http.MethodPost, "/updates", []byte(`[]`)), ErrBadDigest)
+	})
+
+	t.Run("other path", func(t *testing.T) {
+		v := NewVerifier(keys, time.Minute)
+		h := http.Header{}
+		signer.Sign(h, http.MethodPost, "/updates", body)
+		require.ErrorIs(t, v.Verify(h, http.MethodPost, "/update", body), ErrBadSignature)
+	})
+
+	t.Run("retired key", func(t *testing.T) {
+		v := NewVerifier(Keyring{"v2": "new-secret"}, time.Minute)
+		h := http.Header{}
+		Signer{KeyID: "v1", Key: "old-secret"}.Sign(h, http.MethodPost, "/updates", body)
+		require.ErrorIs(t, v.Verify(h, http.MethodPost, "/updates", body), ErrUnknownKey)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		v := NewVerifier(keys, time.Minute)
+		require.ErrorIs(t, v.Verify(http.Header{}, http.MethodPost, "/updates", body), ErrUnsigned)
+	})
+}
+
+func TestKeyring_Set(t *testing.T) {
+	var keys Keyring
+	require.ErrorIs(t, keys.Set("v1"), ErrBadKeyring)
+	require.ErrorIs(t, keys.Set("v1:"), ErrBadKeyring)
+
+	require.NoError(t, keys.Set("v2:b, v1:a"))
+	require.Equal(t, Keyring{"v1": "a", "v2": "b"}, keys)
+	require.Equal(t, "v1,v2", keys.String())
+}
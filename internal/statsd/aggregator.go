@@ -0,0 +1,170 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+)
+
+// Aggregator накапливает значения StatsD между отправками отчетов.
+// Счетчики суммируются, gauge хранит последнее значение (или приращение),
+// таймеры сворачиваются в набор сводных gauge, множества - в число уникальных значений.
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+	timers   map[string]*timerValues
+	sets     map[string]map[string]struct{}
+	dropped  atomic.Int64
+}
+
+// timerValues - значения таймера за окно. count учитывает выборку: значение с @0.1 весит 10.
+type timerValues struct {
+	values []float64
+	count  float64
+}
+
+// counterEpsilon - остаток счетчика меньше этого считается ошибкой округления и не переносится
+const counterEpsilon = 1e-9
+
+// timerPercentiles - перцентили, которые считаются для таймеров
+var timerPercentiles = []struct {
+	suffix string
+	p      float64
+}{
+	{".p50", 0.50},
+	{".p95", 0.95},
+	{".p99", 0.99},
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		timers:   make(map[string]*timerValues),
+		sets:     make(map[string]map[string]struct{}),
+	}
+}
+
+// Add учитывает одно значение.
+func (a *Aggregator) Add(s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.Type {
+	case TypeCounter:
+		a.counters[s.Name] += s.Value / s.SampleRate
+	case TypeGauge:
+		if s.Relative {
+			a.gauges[s.Name] += s.Value
+		} else {
+			a.gauges[s.Name] = s.Value
+		}
+	case TypeTimer, TypeHisto:
+		timer, ok := a.timers[s.Name]
+		if !ok {
+			timer = &timerValues{}
+			a.timers[s.Name] = timer
+		}
+		timer.values = append(timer.values, s.Value)
+		timer.count += 1 / s.SampleRate
+	case TypeSet:
+		set, ok := a.sets[s.Name]
+		if !ok {
+			set = make(map[string]struct{})
+			a.sets[s.Name] = set
+		}
+		set[s.Raw] = struct{}{}
+	}
+}
+
+// Drop учитывает значение, которое не удалось принять.
+func (a *Aggregator) Drop() {
+	a.dropped.Add(1)
+}
+
+// Dropped возвращает число отброшенных значений с момента запуска.
+func (a *Aggregator) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Flush возвращает накопленные метрики и начинает новое окно.
+// Значения gauge сохраняются между окнами, чтобы приращения оставались корректными.
+// Дробная часть счетчика, например от выборки @0.3, переходит в следующее окно.
+func (a *Aggregator) Flush() []models.Metrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]models.Metrics, 0, len(a.counters)+len(a.gauges)+len(a.sets))
+
+	remainders := make(map[string]float64)
+	for name, value := range a.counters {
+		delta := int64(math.Round(value))
+		if rest := value - float64(delta); math.Abs(rest) > counterEpsilon {
+			remainders[name] = rest
+		}
+		if delta == 0 {
+			continue
+		}
+		result = append(result, models.Metrics{ID: name, MType: models.Counter, Delta: lib.IntPtr(delta)})
+	}
+
+	for name, value := range a.gauges {
+		result = append(result, gauge(name, value))
+	}
+
+	for name, timer := range a.timers {
+		result = append(result, summarize(name, timer)...)
+	}
+
+	for name, set := range a.sets {
+		result = append(result, gauge(name, float64(len(set))))
+	}
+
+	a.counters = remainders
+	a.timers = make(map[string]*timerValues)
+	a.sets = make(map[string]map[string]struct{})
+
+	return result
+}
+
+// summarize сворачивает таймер в сводные gauge. Число значений учитывает выборку,
+// остальные сводки считаются по полученным значениям.
+func summarize(name string, timer *timerValues) []models.Metrics {
+	values := timer.values
+	if len(values) == 0 {
+		return nil
+	}
+
+	sort.Float64s(values)
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	result := []models.Metrics{
+		gauge(name+".count", timer.count),
+		gauge(name+".min", values[0]),
+		gauge(name+".max", values[len(values)-1]),
+		gauge(name+".mean", sum/float64(len(values))),
+	}
+
+	for _, p := range timerPercentiles {
+		idx := int(math.Ceil(p.p*float64(len(values)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		result = append(result, gauge(name+p.suffix, values[idx]))
+	}
+
+	return result
+}
+
+func gauge(name string, value float64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: lib.FloatPtr(value)}
+}
@@ -0,0 +1,37 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator_CounterRemainder(t *testing.T) {
+	a := NewAggregator()
+
+	// Каждое значение с выборкой 0.3 весит 3.33..., за три окна - ровно 10
+	var total int64
+	for range 3 {
+		a.Add(Sample{Name: "hits", Type: TypeCounter, Value: 1, SampleRate: 0.3})
+		for _, m := range a.Flush() {
+			total += *m.Delta
+		}
+	}
+	require.EqualValues(t, 10, total)
+}
+
+func TestAggregator_TimerSampleRate(t *testing.T) {
+	a := NewAggregator()
+
+	// Два таймера с выборкой 0.1 означают около 20 измерений
+	a.Add(Sample{Name: "latency", Type: TypeTimer, Value: 10, SampleRate: 0.1})
+	a.Add(Sample{Name: "latency", Type: TypeTimer, Value: 30, SampleRate: 0.1})
+
+	got := make(map[string]float64)
+	for _, m := range a.Flush() {
+		got[m.ID] = *m.Value
+	}
+	require.InDelta(t, 20, got["latency.count"], 1e-9)
+	require.Equal(t, 20.0, got["latency.mean"])
+	require.Equal(t, 10.0, got["latency.min"])
+}
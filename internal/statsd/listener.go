@@ -0,0 +1,108 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const maxPacketSize = 64 * 1024
+
+// Listener принимает пакеты StatsD по UDP или unixgram и передает их в Aggregator.
+type Listener struct {
+	conn       net.PacketConn
+	network    string
+	address    string
+	aggregator *Aggregator
+	log        *zap.Logger
+}
+
+// ParseAddress разбирает адрес вида udp://host:port или unixgram:///path/to/socket.
+// Адрес без схемы считается UDP.
+func ParseAddress(addr string) (string, string, error) {
+	network, address, ok := strings.Cut(addr, "://")
+	if !ok {
+		return "udp", addr, nil
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+	default:
+		return "", "", fmt.Errorf("unsupported statsd network %q", network)
+	}
+
+	if address == "" {
+		return "", "", fmt.Errorf("empty statsd address")
+	}
+	return network, address, nil
+}
+
+// Listen открывает сокет по адресу addr. Пакеты начинают обрабатываться после вызова Serve.
+func Listen(addr string, aggregator *Aggregator, log *zap.Logger) (*Listener, error) {
+	op := "statsd.Listen"
+
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if network == "unixgram" {
+		// Сокет мог остаться от предыдущего запуска
+		_ = os.Remove(address)
+	}
+
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Listener{
+		conn:       conn,
+		network:    network,
+		address:    address,
+		aggregator: aggregator,
+		log:        log,
+	}, nil
+}
+
+// Addr возвращает фактический адрес сокета.
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Serve читает пакеты до закрытия сокета.
+func (l *Listener) Serve() error {
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		samples, errs := ParsePacket(buf[:n])
+		for _, err := range errs {
+			l.log.Debug("statsd: bad line", zap.Error(err))
+			l.aggregator.Drop()
+		}
+		for _, s := range samples {
+			l.aggregator.Add(s)
+		}
+	}
+}
+
+// Close закрывает сокет и удаляет файл unixgram-сокета.
+func (l *Listener) Close() error {
+	err := l.conn.Close()
+	if l.network == "unixgram" {
+		_ = os.Remove(l.address)
+	}
+	return err
+}
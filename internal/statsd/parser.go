@@ -0,0 +1,118 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Типы метрик StatsD
+const (
+	TypeCounter = "c"
+	TypeGauge   = "g"
+	TypeTimer   = "ms"
+	TypeHisto   = "h"
+	TypeSet     = "s"
+)
+
+var (
+	ErrEmptyLine     = errors.New("empty line")
+	ErrBadFormat     = errors.New("line must be name:value|type")
+	ErrBadValue      = errors.New("invalid metric value")
+	ErrBadType       = errors.New("unsupported metric type")
+	ErrBadSampleRate = errors.New("invalid sample rate")
+)
+
+// Sample - одно значение, разобранное из строки StatsD.
+type Sample struct {
+	// Name - имя метрики
+	Name string
+	// Type - тип метрики StatsD (c, g, ms, h, s)
+	Type string
+	// Value - числовое значение (для s не используется)
+	Value float64
+	// Raw - исходное значение, используется для множеств
+	Raw string
+	// Relative - значение gauge задано со знаком и является приращением
+	Relative bool
+	// SampleRate - частота семплирования, 1 если не задана
+	SampleRate float64
+}
+
+// Parse разбирает одну строку вида name:value|type|@rate|#tags.
+// Теги DogStatsD допускаются, но игнорируются.
+func Parse(line string) (Sample, error) {
+	op := "statsd.Parse"
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return Sample{}, ErrEmptyLine
+	}
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" || rest == "" {
+		return Sample{}, fmt.Errorf("%s: %q: %w", op, line, ErrBadFormat)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 || parts[0] == "" {
+		return Sample{}, fmt.Errorf("%s: %q: %w", op, line, ErrBadFormat)
+	}
+
+	s := Sample{
+		Name:       name,
+		Type:       parts[1],
+		Raw:        parts[0],
+		SampleRate: 1,
+	}
+
+	for _, p := range parts[2:] {
+		if strings.HasPrefix(p, "@") {
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("%s: %q: %w", op, line, ErrBadSampleRate)
+			}
+			s.SampleRate = rate
+		}
+	}
+
+	switch s.Type {
+	case TypeSet:
+		return s, nil
+	case TypeGauge:
+		s.Relative = strings.HasPrefix(s.Raw, "+") || strings.HasPrefix(s.Raw, "-")
+	case TypeCounter, TypeTimer, TypeHisto:
+	default:
+		return Sample{}, fmt.Errorf("%s: %q: %w", op, s.Type, ErrBadType)
+	}
+
+	v, err := strconv.ParseFloat(s.Raw, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("%s: %q: %w", op, s.Raw, ErrBadValue)
+	}
+	s.Value = v
+
+	return s, nil
+}
+
+// ParsePacket разбирает пакет, содержащий одну или несколько строк.
+// Возвращает успешно разобранные значения и ошибки для остальных строк.
+func ParsePacket(packet []byte) ([]Sample, []error) {
+	var samples []Sample
+	var errs []error
+
+	for _, line := range strings.Split(string(packet), "\n") {
+		s, err := Parse(line)
+		if errors.Is(err, ErrEmptyLine) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, errs
+}
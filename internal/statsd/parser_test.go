@@ -0,0 +1,118 @@
+package statsd
+
+import (
+	"testing"
+
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{
+			name: "Counter",
+			line: "requests:1|c",
+			want: Sample{Name: "requests", Type: TypeCounter, Value: 1, Raw: "1", SampleRate: 1},
+		},
+		{
+			name: "Counter with sample rate",
+			line: "requests:2|c|@0.5",
+			want: Sample{Name: "requests", Type: TypeCounter, Value: 2, Raw: "2", SampleRate: 0.5},
+		},
+		{
+			name: "Relative gauge",
+			line: "queue:-3|g",
+			want: Sample{Name: "queue", Type: TypeGauge, Value: -3, Raw: "-3", Relative: true, SampleRate: 1},
+		},
+		{
+			name: "Timer with tags",
+			line: "latency:12.5|ms|#env:prod",
+			want: Sample{Name: "latency", Type: TypeTimer, Value: 12.5, Raw: "12.5", SampleRate: 1},
+		},
+		{
+			name: "Set",
+			line: "users:alice|s",
+			want: Sample{Name: "users", Type: TypeSet, Raw: "alice", SampleRate: 1},
+		},
+		{
+			name:    "No type",
+			line:    "requests:1",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown type",
+			line:    "requests:1|x",
+			wantErr: true,
+		},
+		{
+			name:    "Bad value",
+			line:    "requests:abc|c",
+			wantErr: true,
+		},
+		{
+			name:    "Bad sample rate",
+			line:    "requests:1|c|@2",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.line)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	samples, errs := ParsePacket([]byte("a:1|c\n\nb:2|g\nbroken\n"))
+	require.Len(t, samples, 2)
+	require.Len(t, errs, 1)
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	a := NewAggregator()
+
+	for _, line := range []string{
+		"hits:1|c|@0.5",
+		"hits:3|c",
+		"temp:10|g",
+		"temp:+5|g",
+		"rt:10|ms",
+		"rt:30|ms",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+	} {
+		s, err := Parse(line)
+		require.NoError(t, err)
+		a.Add(s)
+	}
+
+	got := make(map[string]models.Metrics)
+	for _, m := range a.Flush() {
+		got[m.ID] = m
+	}
+
+	require.Equal(t, int64(5), *got["hits"].Delta)
+	require.Equal(t, 15.0, *got["temp"].Value)
+	require.Equal(t, 2.0, *got["rt.count"].Value)
+	require.Equal(t, 10.0, *got["rt.min"].Value)
+	require.Equal(t, 30.0, *got["rt.max"].Value)
+	require.Equal(t, 20.0, *got["rt.mean"].Value)
+	require.Equal(t, 2.0, *got["users"].Value)
+
+	// Во втором окне остаются только gauge
+	second := a.Flush()
+	require.Len(t, second, 1)
+	require.Equal(t, "temp", second[0].ID)
+}
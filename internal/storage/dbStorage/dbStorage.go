@@ -35,12 +35,13 @@ func NewPostgresStorage(ctx context.Context, DSN customtype.DSN) (*PostgresStora
 
 }
 
+// Set записывает метрику арендатора из value.Tenant.
 func (p *PostgresStorage) Set(key string, value models.Metrics) error {
 	err := retries.ExecuteWithRetry(p.ctx, func() error {
 		q := fmt.Sprintf(`
-		INSERT INTO %s (name, type, delta, value, hash)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (name)
+		INSERT INTO %s (tenant, name, type, delta, value, hash)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, name)
 		DO UPDATE SET
 			type = EXCLUDED.type,
 			delta = %s.delta + EXCLUDED.delta,
@@ -48,7 +49,7 @@ func (p *PostgresStorage) Set(key string, value models.Metrics) error {
 			hash = EXCLUDED.hash;
 		`, p.tableName, p.tableName)
 
-		_, err := p.db.ExecContext(p.ctx, q, key, value.MType, value.Delta, value.Value, value.Hash)
+		_, err := p.db.ExecContext(p.ctx, q, value.Tenant, key, value.MType, value.Delta, value.Value, value.Hash)
 
 		return err
 	})
@@ -56,12 +57,17 @@ func (p *PostgresStorage) Set(key string, value models.Metrics) error {
 	return err
 }
 
+// Get возвращает метрику арендатора по умолчанию.
 func (p *PostgresStorage) Get(key string) (models.Metrics, bool) {
-	q := fmt.Sprintf(`SELECT name, type, delta, value, hash FROM %s WHERE name = $1`, p.tableName)
-	row := p.db.QueryRowContext(p.ctx, q, key)
+	return p.get("", key)
+}
+
+func (p *PostgresStorage) get(tenant, key string) (models.Metrics, bool) {
+	q := fmt.Sprintf(`SELECT tenant, name, type, delta, value, hash FROM %s WHERE tenant = $1 AND name = $2`, p.tableName)
+	row := p.db.QueryRowContext(p.ctx, q, tenant, key)
 
 	var m models.Metrics
-	err := row.Scan(&m.ID, &m.MType, &m.Delta, &m.Value, &m.Hash)
+	err := row.Scan(&m.Tenant, &m.ID, &m.MType, &m.Delta, &m.Value, &m.Hash)
 	if err == sql.ErrNoRows {
 		return models.Metrics{}, false
 	}
@@ -71,28 +77,40 @@ func (p *PostgresStorage) Get(key string) (models.Metrics, bool) {
 	return m, true
 }
 
+// GetAll возвращает метрики арендатора по умолчанию.
 func (p *PostgresStorage) GetAll() (map[string]models.Metrics, error) {
-	q := fmt.Sprintf(`SELECT name, type, delta, value, hash FROM %s`, p.tableName)
-	rows, err := p.db.QueryContext(p.ctx, q)
+	return p.ForTenant("").GetAll()
+}
+
+// GetAllTenants возвращает метрики всех арендаторов.
+func (p *PostgresStorage) GetAllTenants() ([]models.Metrics, error) {
+	return p.query(``)
+}
+
+func (p *PostgresStorage) query(where string, args ...any) ([]models.Metrics, error) {
+	q := fmt.Sprintf(`SELECT tenant, name, type, delta, value, hash FROM %s %s`, p.tableName, where)
+	rows, err := p.db.QueryContext(p.ctx, q, args...)
 	if err != nil {
-		return map[string]models.Metrics{}, err
-	}
-	if err := rows.Err(); err != nil {
-		return map[string]models.Metrics{}, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	result := make(map[string]models.Metrics)
+	var result []models.Metrics
 	for rows.Next() {
-		var m models.Metrics
-		if err := rows.Scan(&m.ID, &m.MType, &m.Delta, &m.Value); err != nil {
+		var (
+			m    models.Metrics
+			hash sql.NullString
+		)
+		if err := rows.Scan(&m.Tenant, &m.ID, &m.MType, &m.Delta, &m.Value, &hash); err != nil {
 			continue
 		}
-		result[m.ID] = m
+		m.Hash = hash.String
+		result = append(result, m)
 	}
-	return result, nil
+	return result, rows.Err()
 }
 
+// SetAll записывает метрики арендаторов из их поля Tenant.
 func (p *PostgresStorage) SetAll(metrics []models.Metrics) error {
 	err := retries.ExecuteWithRetry(p.ctx, func() error {
 		tx, err := p.db.Begin()
@@ -103,9 +121,9 @@ func (p *PostgresStorage) SetAll(metrics []models.Metrics) error {
 		defer tx.Rollback()
 
 		stmt, err := tx.PrepareContext(p.ctx, fmt.Sprintf(`
-			INSERT INTO %s (name, type, delta, value, hash) 
-			VALUES ($1, $2, $3, $4, $5) 		
-			ON CONFLICT (name)
+			INSERT INTO %s (tenant, name, type, delta, value, hash) 
+			VALUES ($1, $2, $3, $4, $5, $6) 		
+			ON CONFLICT (tenant, name)
 			DO UPDATE SET 
 				type = EXCLUDED.type,
 				delta = %s.delta + EXCLUDED.delta,
@@ -118,7 +136,7 @@ func (p *PostgresStorage) SetAll(metrics []models.Metrics) error {
 		defer stmt.Close()
 
 		for _, val := range metrics {
-			_, err := stmt.ExecContext(p.ctx, val.ID, val.MType, val.Delta, val.Value, val.Hash)
+			_, err := stmt.ExecContext(p.ctx, val.Tenant, val.ID, val.MType, val.Delta, val.Value, val.Hash)
 			if err != nil {
 				return err
 			}
@@ -128,6 +146,48 @@ func (p *PostgresStorage) SetAll(metrics []models.Metrics) error {
 	return err
 }
 
+// ForTenant возвращает метрики арендатора tenant.
+func (p *PostgresStorage) ForTenant(tenant string) *TenantView {
+	return &TenantView{p: p, tenant: tenant}
+}
+
+// TenantView - метрики одного арендатора PostgresStorage.
+type TenantView struct {
+	p      *PostgresStorage
+	tenant string
+}
+
+func (v *TenantView) Set(key string, value models.Metrics) error {
+	value.Tenant = v.tenant
+	return v.p.Set(key, value)
+}
+
+func (v *TenantView) Get(key string) (models.Metrics, bool) {
+	return v.p.get(v.tenant, key)
+}
+
+func (v *TenantView) GetAll() (map[string]models.Metrics, error) {
+	metrics, err := v.p.query(`WHERE tenant = $1`, v.tenant)
+	if err != nil {
+		return map[string]models.Metrics{}, err
+	}
+
+	result := make(map[string]models.Metrics, len(metrics))
+	for _, m := range metrics {
+		result[m.ID] = m
+	}
+	return result, nil
+}
+
+func (v *TenantView) SetAll(metrics []models.Metrics) error {
+	batch := make([]models.Metrics, len(metrics))
+	for i, m := range metrics {
+		m.Tenant = v.tenant
+		batch[i] = m
+	}
+	return v.p.SetAll(batch)
+}
+
 /*
 	Set(key string, value models.Metrics) error
 	Get(key string) (models.Metrics, bool)
@@ -70,14 +70,20 @@ func (p *Producer) WriteMetric(metric models.Metrics) error {
 
 	storageMap := make(map[string]models.Metrics, len(oldMetrics))
 	for _, m := range oldMetrics {
-		storageMap[m.ID] = m
+		storageMap[Key(m)] = m
 	}
 
-	storageMap[metric.ID] = metric
+	storageMap[Key(metric)] = metric
 
 	return p.WriteMetrics(storageMap)
 }
 
+// Key возвращает ключ метрики для WriteMetrics: метрики разных арендаторов с одним ID хранятся отдельно.
+// Нулевой байт не встречается в именах арендаторов, поэтому ключи разных метрик не совпадают.
+func Key(m models.Metrics) string {
+	return m.Tenant + "\x00" + m.ID
+}
+
 func NewConsumer(filename string) (*Consumer, error) {
 	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
 	if err != nil {
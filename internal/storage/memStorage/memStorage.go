@@ -7,21 +7,30 @@ import (
 	models "github.com/s0n1cAK/yandex-metrics/internal/model"
 )
 
+// key - метрика арендатора. У арендатора по умолчанию tenant пустой.
+type key struct {
+	tenant string
+	id     string
+}
+
+// MemStorage хранит метрики всех арендаторов.
+// Set и SetAll записывают метрику арендатора из ее поля Tenant,
+// остальные методы работают с арендатором по умолчанию. Для остальных арендаторов используется ForTenant.
 type MemStorage struct {
-	values map[string]models.Metrics
+	values map[key]models.Metrics
 	mu     sync.RWMutex
 }
 
 func New() *MemStorage {
 	return &MemStorage{
-		values: make(map[string]models.Metrics),
+		values: make(map[key]models.Metrics),
 	}
 }
 
-func (s *MemStorage) Set(key string, value models.Metrics) error {
+func (s *MemStorage) Set(id string, value models.Metrics) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if key == "" {
+	if id == "" {
 		return fmt.Errorf("empty key")
 	}
 
@@ -33,36 +42,60 @@ func (s *MemStorage) Set(key string, value models.Metrics) error {
 		return fmt.Errorf("%s unsupported type of metric", value.MType)
 	}
 
-	existing, exists := s.values[key]
+	k := key{tenant: value.Tenant, id: id}
+
+	existing, exists := s.values[k]
 	if exists && existing.MType != value.MType {
 		return fmt.Errorf("%s already in storage with type %s", existing.ID, existing.MType)
 	}
 
 	if value.MType == models.Counter {
-		if old, ok := s.values[key]; ok && old.Delta != nil && value.Delta != nil {
+		if old, ok := s.values[k]; ok && old.Delta != nil && value.Delta != nil {
 			sum := *old.Delta + *value.Delta
 			value.Delta = &sum
 		}
 	}
 
-	s.values[key] = value
+	s.values[k] = value
 	return nil
 }
 
-func (s *MemStorage) Get(key string) (models.Metrics, bool) {
+func (s *MemStorage) Get(id string) (models.Metrics, bool) {
+	return s.get("", id)
+}
+
+func (s *MemStorage) get(tenant, id string) (models.Metrics, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	val, ok := s.values[key]
+	val, ok := s.values[key{tenant: tenant, id: id}]
 	return val, ok
 }
 
 func (s *MemStorage) GetAll() (map[string]models.Metrics, error) {
+	return s.getAll(""), nil
+}
+
+func (s *MemStorage) getAll(tenant string) map[string]models.Metrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metrics := make(map[string]models.Metrics)
+	for k, data := range s.values {
+		if k.tenant == tenant {
+			metrics[k.id] = data
+		}
+	}
+	return metrics
+}
+
+// GetAllTenants возвращает метрики всех арендаторов.
+func (s *MemStorage) GetAllTenants() ([]models.Metrics, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	metrics := make(map[string]models.Metrics, len(s.values))
-	for name, data := range s.values {
-		metrics[name] = data
+	metrics := make([]models.Metrics, 0, len(s.values))
+	for _, data := range s.values {
+		metrics = append(metrics, data)
 	}
 	return metrics, nil
 }
@@ -79,7 +112,9 @@ func (s *MemStorage) SetAll(metrics []models.Metrics) error {
 			return fmt.Errorf("unsupported type %s", value.MType)
 		}
 
-		existing, exists := s.values[value.ID]
+		k := key{tenant: value.Tenant, id: value.ID}
+
+		existing, exists := s.values[k]
 		if exists && existing.MType != value.MType {
 			return fmt.Errorf("type mismatch for %s: existing %s, new %s", value.ID, existing.MType, value.MType)
 		}
@@ -95,7 +130,7 @@ func (s *MemStorage) SetAll(metrics []models.Metrics) error {
 			value.Delta = &newDelta
 		}
 
-		s.values[value.ID] = value
+		s.values[k] = value
 	}
 	return nil
 }
@@ -108,8 +143,72 @@ func (s *MemStorage) Clear() {
 	}
 }
 
-func (s *MemStorage) Delete(key string) {
+func (s *MemStorage) Delete(id string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.values, key)
+	delete(s.values, key{id: id})
+}
+
+// CompareAndDelete удаляет метрику id, только если она не изменилась с момента чтения значения old.
+// Возвращает false, если метрика изменилась и осталась в хранилище.
+func (s *MemStorage) CompareAndDelete(id string, old models.Metrics) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key{id: id}
+	current, ok := s.values[k]
+	if !ok {
+		return true
+	}
+	if !sameValue(current, old) {
+		return false
+	}
+	delete(s.values, k)
+	return true
+}
+
+func sameValue(a, b models.Metrics) bool {
+	if a.MType != b.MType {
+		return false
+	}
+	switch {
+	case a.Value != nil && b.Value != nil:
+		return *a.Value == *b.Value
+	case a.Delta != nil && b.Delta != nil:
+		return *a.Delta == *b.Delta
+	}
+	return a.Value == nil && b.Value == nil && a.Delta == nil && b.Delta == nil
+}
+
+// ForTenant возвращает метрики арендатора tenant.
+func (s *MemStorage) ForTenant(tenant string) *TenantView {
+	return &TenantView{s: s, tenant: tenant}
+}
+
+// TenantView - метрики одного арендатора MemStorage.
+type TenantView struct {
+	s      *MemStorage
+	tenant string
+}
+
+func (v *TenantView) Set(id string, value models.Metrics) error {
+	value.Tenant = v.tenant
+	return v.s.Set(id, value)
+}
+
+func (v *TenantView) Get(id string) (models.Metrics, bool) {
+	return v.s.get(v.tenant, id)
+}
+
+func (v *TenantView) GetAll() (map[string]models.Metrics, error) {
+	return v.s.getAll(v.tenant), nil
+}
+
+func (v *TenantView) SetAll(metrics []models.Metrics) error {
+	batch := make([]models.Metrics, len(metrics))
+	for i, m := range metrics {
+		m.Tenant = v.tenant
+		batch[i] = m
+	}
+	return v.s.SetAll(batch)
 }
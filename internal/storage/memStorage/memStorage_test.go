@@ -119,3 +119,54 @@ func TestMemStorage_Set(t *testing.T) {
 		})
 	}
 }
+
+func TestMemStorage_ForTenant(t *testing.T) {
+	storage := New()
+	teamA := storage.ForTenant("team-a")
+
+	require.NoError(t, storage.Set("requests", models.Metrics{ID: "requests", MType: models.Counter, Delta: lib.IntPtr(1)}))
+	require.NoError(t, teamA.Set("requests", models.Metrics{ID: "requests", MType: models.Counter, Delta: lib.IntPtr(10)}))
+	require.NoError(t, teamA.SetAll([]models.Metrics{{ID: "requests", MType: models.Counter, Delta: lib.IntPtr(5)}}))
+
+	// Одинаковые имена у разных арендаторов не смешиваются
+	def, ok := storage.Get("requests")
+	require.True(t, ok)
+	require.Equal(t, int64(1), *def.Delta)
+
+	own, ok := teamA.Get("requests")
+	require.True(t, ok)
+	require.Equal(t, int64(15), *own.Delta)
+	require.Equal(t, "team-a", own.Tenant)
+
+	_, ok = storage.ForTenant("team-b").Get("requests")
+	require.False(t, ok)
+
+	all, err := storage.GetAllTenants()
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	// Восстановление из файла возвращает метрики их арендаторам
+	restored := New()
+	require.NoError(t, restored.SetAll(all))
+	own, ok = restored.ForTenant("team-a").Get("requests")
+	require.True(t, ok)
+	require.Equal(t, int64(15), *own.Delta)
+}
+
+func TestMemStorage_CompareAndDelete(t *testing.T) {
+	storage := New()
+
+	sent := models.Metrics{ID: "g", MType: models.Gauge, Value: lib.FloatPtr(1)}
+	require.NoError(t, storage.Set("g", sent))
+	require.NoError(t, storage.Set("g", models.Metrics{ID: "g", MType: models.Gauge, Value: lib.FloatPtr(2)}))
+
+	// Значение изменилось после чтения и остается в хранилище
+	require.False(t, storage.CompareAndDelete("g", sent))
+	current, ok := storage.Get("g")
+	require.True(t, ok)
+	require.Equal(t, 2.0, *current.Value)
+
+	require.True(t, storage.CompareAndDelete("g", current))
+	_, ok = storage.Get("g")
+	require.False(t, ok)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/s0n1cAK/yandex-metrics/internal/config/server"
@@ -11,6 +12,8 @@ import (
 	"go.uber.org/zap"
 )
 
+var ErrNoTenants = errors.New("storage does not separate tenants")
+
 type BasicStorage interface {
 	Set(key string, value models.Metrics) error
 	Get(key string) (models.Metrics, bool)
@@ -33,3 +36,38 @@ func New(ctx context.Context, cfg server.Config, log *zap.Logger) (BasicStorage,
 	s := memstorage.New()
 	return s, nil
 }
+
+// ForTenant возвращает метрики арендатора tenant.
+// Хранилище, не разделяющее арендаторов, подходит только для арендатора по умолчанию,
+// для остальных возвращается ErrNoTenants: иначе их метрики смешались бы.
+func ForTenant(s BasicStorage, tenant string) (BasicStorage, error) {
+	switch st := s.(type) {
+	case *memstorage.MemStorage:
+		return st.ForTenant(tenant), nil
+	case *dbstorage.PostgresStorage:
+		return st.ForTenant(tenant), nil
+	}
+	if tenant == "" {
+		return s, nil
+	}
+	return nil, fmt.Errorf("storage.ForTenant: %w: %T", ErrNoTenants, s)
+}
+
+// AllTenants возвращает метрики всех арендаторов с заполненным полем Tenant.
+func AllTenants(s BasicStorage) ([]models.Metrics, error) {
+	if st, ok := s.(interface {
+		GetAllTenants() ([]models.Metrics, error)
+	}); ok {
+		return st.GetAllTenants()
+	}
+
+	all, err := s.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]models.Metrics, 0, len(all))
+	for _, m := range all {
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
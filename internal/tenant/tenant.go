@@ -0,0 +1,87 @@
+// Package tenant разделяет метрики нескольких команд на одном сервере.
+//
+// Арендатор запроса берется из токена доступа или заголовка Header. Метрики, аудит,
+// ключ HashSHA256 и квоты у каждого арендатора свои. Default - арендатор запросов
+// без явного указания, его метрики хранятся так же, как до появления арендаторов.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Header - заголовок, которым клиент выбирает арендатора
+const Header = "X-Tenant"
+
+// Default - арендатор по умолчанию
+const Default = ""
+
+var (
+	ErrBadName  = errors.New("tenant name must be 1-64 characters of a-z, 0-9, '-' and '_'")
+	ErrMismatch = errors.New("tenant does not match token")
+	ErrUnknown  = errors.New("unknown tenant")
+)
+
+var nameRe = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// Validate проверяет имя арендатора. Default допустим.
+func Validate(name string) error {
+	if name != Default && !nameRe.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrBadName, name)
+	}
+	return nil
+}
+
+// Settings - настройки арендатора.
+type Settings struct {
+	// HashKey - ключ HashSHA256 арендатора вместо общего KEY сервера
+	HashKey string `json:"hash_key,omitempty"`
+	// AuditFile и AuditURL - приемники аудита арендатора в дополнение к общим
+	AuditFile string `json:"audit_file,omitempty"`
+	AuditURL  string `json:"audit_url,omitempty"`
+	// MaxMetrics - наибольшее число разных метрик арендатора, 0 не ограничивает
+	MaxMetrics int `json:"max_metrics,omitempty"`
+	// MaxBatch - наибольшее число метрик в одном запросе /updates, 0 не ограничивает
+	MaxBatch int `json:"max_batch,omitempty"`
+}
+
+// Load читает настройки арендаторов из JSON-файла вида {"team-a": {"hash_key": "..."}}.
+func Load(path string) (map[string]Settings, error) {
+	op := "tenant.Load"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var tenants map[string]Settings
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for name, s := range tenants {
+		if err := Validate(name); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if s.MaxMetrics < 0 || s.MaxBatch < 0 {
+			return nil, fmt.Errorf("%s: %s: quotas must not be negative", op, name)
+		}
+	}
+	return tenants, nil
+}
+
+type ctxKey struct{}
+
+// WithContext сохраняет арендатора запроса в контексте.
+func WithContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, name)
+}
+
+// FromContext возвращает арендатора, сохраненного WithContext, или Default.
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(ctxKey{}).(string)
+	return name
+}
@@ -0,0 +1,170 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FileStore хранит токены в JSON-файле.
+// Файл перечитывается при изменении, поэтому токены, созданные командой tokens, действуют без перезапуска сервера.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	tokens  []Token
+	modTime time.Time
+}
+
+// NewFileStore создает хранилище в файле path. Отсутствующий файл считается пустым.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Create(_ context.Context, t Token) error {
+	op := "tokens.FileStore.Create"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if slices.ContainsFunc(s.tokens, func(old Token) bool { return old.ID == t.ID || old.Hash == t.Hash }) {
+		return fmt.Errorf("%s: %w", op, ErrDuplicated)
+	}
+
+	if err := s.save(append(slices.Clone(s.tokens), t)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Revoke(_ context.Context, id string) error {
+	op := "tokens.FileStore.Revoke"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	i := slices.IndexFunc(s.tokens, func(t Token) bool { return t.ID == id })
+	if i < 0 {
+		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	if s.tokens[i].Revoked() {
+		return nil
+	}
+
+	tokens := slices.Clone(s.tokens)
+	now := time.Now().UTC().Truncate(time.Second)
+	tokens[i].RevokedAt = &now
+
+	if err := s.save(tokens); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *FileStore) List(_ context.Context) ([]Token, error) {
+	op := "tokens.FileStore.List"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return slices.Clone(s.tokens), nil
+}
+
+func (s *FileStore) Lookup(_ context.Context, hash string) (Token, error) {
+	op := "tokens.FileStore.Lookup"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return Token{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	i := slices.IndexFunc(s.tokens, func(t Token) bool { return t.Hash == hash })
+	if i < 0 {
+		return Token{}, ErrNotFound
+	}
+	return s.tokens[i], nil
+}
+
+// reload перечитывает файл, если он изменился после последнего чтения.
+func (s *FileStore) reload() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.tokens = nil
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && s.tokens != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	tokens := []Token{}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+
+	s.tokens = tokens
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// save записывает токены во временный файл и заменяет им прежний,
+// чтобы сервер не прочитал файл, записанный наполовину.
+func (s *FileStore) save(tokens []Token) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.tokens = tokens
+	s.modTime = time.Time{}
+	return nil
+}
@@ -0,0 +1,164 @@
+package tokens
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/config/db"
+	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"github.com/s0n1cAK/yandex-metrics/internal/retries"
+)
+
+// StorePostgres - значение TOKEN_STORE, при котором токены хранятся в таблице api_tokens базы DATABASE_DSN
+const StorePostgres = "postgres"
+
+// PostgresStore хранит токены в таблице api_tokens.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore подключается к базе DSN и применяет миграции.
+func NewPostgresStore(ctx context.Context, DSN customtype.DSN) (*PostgresStore, error) {
+	op := "tokens.NewPostgresStore"
+
+	if err := db.Migration(ctx, DSN); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	conn, err := retries.OpenDBWithRetry(ctx, DSN.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &PostgresStore{db: conn}, nil
+}
+
+// Close закрывает подключение к базе.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresStore) Create(ctx context.Context, t Token) error {
+	op := "tokens.PostgresStore.Create"
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_tokens (id, name, hash, scopes, tenant, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		t.ID, t.Name, t.Hash, joinScopes(t.Scopes), t.Tenant, t.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Revoke(ctx context.Context, id string) error {
+	op := "tokens.PostgresStore.Revoke"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE api_tokens SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`,
+		id, time.Now().UTC().Truncate(time.Second),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *PostgresStore) List(ctx context.Context) ([]Token, error) {
+	op := "tokens.PostgresStore.List"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, hash, scopes, tenant, created_at, revoked_at FROM api_tokens ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var list []Token
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		list = append(list, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return list, nil
+}
+
+func (s *PostgresStore) Lookup(ctx context.Context, hash string) (Token, error) {
+	op := "tokens.PostgresStore.Lookup"
+
+	row := s.db.QueryRowContext(ctx,
+		`SELECT id, name, hash, scopes, tenant, created_at, revoked_at FROM api_tokens WHERE hash = $1`, hash)
+
+	t, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, ErrNotFound
+	}
+	if err != nil {
+		return Token{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return t, nil
+}
+
+func scanToken(row interface{ Scan(...any) error }) (Token, error) {
+	var (
+		t       Token
+		scopes  string
+		revoked sql.NullTime
+	)
+	if err := row.Scan(&t.ID, &t.Name, &t.Hash, &scopes, &t.Tenant, &t.CreatedAt, &revoked); err != nil {
+		return Token{}, err
+	}
+	for _, s := range strings.Split(scopes, ",") {
+		if s != "" {
+			t.Scopes = append(t.Scopes, Scope(s))
+		}
+	}
+	if revoked.Valid {
+		t.RevokedAt = &revoked.Time
+	}
+	return t, nil
+}
+
+func joinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Open возвращает хранилище по значению TOKEN_STORE: StorePostgres или путь к JSON-файлу.
+// Пустое значение отключает проверку токенов, тогда возвращается nil.
+func Open(ctx context.Context, store string, DSN customtype.DSN) (Store, error) {
+	switch store {
+	case "":
+		return nil, nil
+	case StorePostgres:
+		s, err := NewPostgresStore(ctx, DSN)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return NewFileStore(store), nil
+}
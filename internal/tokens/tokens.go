@@ -0,0 +1,190 @@
+// Package tokens описывает токены доступа к API сервера и их хранилища.
+//
+// Токен показывается один раз при создании, хранится только его SHA-256.
+// Права токена задаются областями: read - чтение метрик, write - запись, admin - все остальное.
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scope - область прав токена.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	// ScopeAdmin включает все остальные области
+	ScopeAdmin Scope = "admin"
+)
+
+var (
+	ErrNoToken    = errors.New("bearer token is missing")
+	ErrBadToken   = errors.New("unknown token")
+	ErrRevoked    = errors.New("token is revoked")
+	ErrNotFound   = errors.New("token not found")
+	ErrBadScope   = errors.New("scope must be one of read, write, admin")
+	ErrEmptyName  = errors.New("token name is empty")
+	ErrDuplicated = errors.New("token already exists")
+)
+
+// Token - сведения о токене без его значения.
+type Token struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Hash   string  `json:"hash"`
+	Scopes []Scope `json:"scopes"`
+	// Tenant - арендатор, к метрикам которого дает доступ токен; пустой у токенов без арендатора
+	Tenant    string     `json:"tenant,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Allows сообщает, разрешает ли токен действия области scope.
+func (t Token) Allows(scope Scope) bool {
+	return slices.Contains(t.Scopes, ScopeAdmin) || slices.Contains(t.Scopes, scope)
+}
+
+// Revoked сообщает, отозван ли токен.
+func (t Token) Revoked() bool {
+	return t.RevokedAt != nil
+}
+
+// Store хранит токены.
+type Store interface {
+	// Create сохраняет новый токен
+	Create(ctx context.Context, t Token) error
+	// Revoke отзывает токен с идентификатором id
+	Revoke(ctx context.Context, id string) error
+	// List возвращает все токены, включая отозванные
+	List(ctx context.Context) ([]Token, error)
+	// Lookup ищет токен по хешу значения
+	Lookup(ctx context.Context, hash string) (Token, error)
+}
+
+// ParseScopes разбирает области из строки через запятую.
+func ParseScopes(value string) ([]Scope, error) {
+	var scopes []Scope
+	for _, s := range strings.Split(value, ",") {
+		scope := Scope(strings.TrimSpace(s))
+		switch scope {
+		case "":
+			continue
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrBadScope, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, ErrBadScope
+	}
+	return scopes, nil
+}
+
+// Hash возвращает SHA-256 значения токена в hex.
+// Значение случайное и длинное, поэтому медленный хеш для паролей не нужен.
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate создает токен с именем name и областями scopes.
+// Возвращает значение для клиента и запись для хранилища. Арендатора задает вызывающий в поле Tenant.
+func Generate(name string, scopes []Scope) (string, Token, error) {
+	op := "tokens.Generate"
+
+	if strings.TrimSpace(name) == "" {
+		return "", Token{}, fmt.Errorf("%s: %w", op, ErrEmptyName)
+	}
+	if len(scopes) == 0 {
+		return "", Token{}, fmt.Errorf("%s: %w", op, ErrBadScope)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", Token{}, fmt.Errorf("%s: %w", op, err)
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", Token{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Идентификатор в значении помогает найти токен в списке, не раскрывая секрет
+	value := id + "." + secret
+
+	return value, Token{
+		ID:        id,
+		Name:      name,
+		Hash:      Hash(value),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Authenticate ищет действующий токен по значению value.
+func Authenticate(ctx context.Context, store Store, value string) (Token, error) {
+	if value == "" {
+		return Token{}, ErrNoToken
+	}
+
+	t, err := store.Lookup(ctx, Hash(value))
+	if errors.Is(err, ErrNotFound) {
+		return Token{}, ErrBadToken
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if t.Revoked() {
+		return Token{}, ErrRevoked
+	}
+	return t, nil
+}
+
+// FromHeader возвращает значение токена из заголовка Authorization: Bearer.
+func FromHeader(h http.Header) string {
+	scheme, value, ok := strings.Cut(h.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// SetHeader добавляет токен value в заголовок Authorization, пустой value ничего не меняет.
+func SetHeader(h http.Header, value string) {
+	if value != "" {
+		h.Set("Authorization", "Bearer "+value)
+	}
+}
+
+type ctxKey struct{}
+
+// WithContext сохраняет токен запроса в контексте.
+func WithContext(ctx context.Context, t Token) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext возвращает токен, сохраненный WithContext.
+func FromContext(ctx context.Context) (Token, bool) {
+	t, ok := ctx.Value(ctxKey{}).(Token)
+	return t, ok
+}
@@ -0,0 +1,58 @@
+package tokens
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	// Команда tokens и сервер работают с файлом из разных процессов
+	cli := NewFileStore(path)
+	srv := NewFileStore(path)
+
+	_, err := Authenticate(ctx, srv, "missing")
+	require.ErrorIs(t, err, ErrBadToken)
+
+	value, token, err := Generate("agent", []Scope{ScopeWrite})
+	require.NoError(t, err)
+	require.NotContains(t, token.Hash, value)
+	require.NoError(t, cli.Create(ctx, token))
+
+	got, err := Authenticate(ctx, srv, value)
+	require.NoError(t, err)
+	require.Equal(t, "agent", got.Name)
+	require.True(t, got.Allows(ScopeWrite))
+	require.False(t, got.Allows(ScopeRead))
+
+	require.NoError(t, cli.Revoke(ctx, token.ID))
+	_, err = Authenticate(ctx, srv, value)
+	require.ErrorIs(t, err, ErrRevoked)
+
+	require.ErrorIs(t, cli.Revoke(ctx, "unknown"), ErrNotFound)
+
+	list, err := srv.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.True(t, list[0].Revoked())
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("read, write,read")
+	require.NoError(t, err)
+	require.Equal(t, []Scope{ScopeRead, ScopeWrite}, scopes)
+
+	_, err = ParseScopes("root")
+	require.ErrorIs(t, err, ErrBadScope)
+	_, err = ParseScopes("")
+	require.ErrorIs(t, err, ErrBadScope)
+
+	admin := Token{Scopes: []Scope{ScopeAdmin}}
+	require.True(t, admin.Allows(ScopeRead))
+	require.True(t, admin.Allows(ScopeWrite))
+}
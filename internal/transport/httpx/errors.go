@@ -15,6 +15,9 @@ func WriteError(w http.ResponseWriter, err error) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 	case errors.Is(err, domain.ErrNotFound):
 		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		// Повтор не поможет, пока арендатор не удалит метрики или не получит большую квоту
+		http.Error(w, err.Error(), http.StatusForbidden)
 	default:
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 	}
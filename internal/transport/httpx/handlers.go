@@ -9,7 +9,11 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/s0n1cAK/yandex-metrics/internal/domain"
+	"github.com/s0n1cAK/yandex-metrics/internal/identity"
+	"github.com/s0n1cAK/yandex-metrics/internal/inventory"
 	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/remoteconfig"
+	"github.com/s0n1cAK/yandex-metrics/internal/scrape"
 	"github.com/s0n1cAK/yandex-metrics/internal/service/metrics"
 )
 
@@ -140,6 +144,21 @@ func GetMetrics(svc metrics.Service) http.HandlerFunc {
 	}
 }
 
+// GetAllMetrics возвращает HTTP-обработчик с метриками всех арендаторов для администратора.
+// Пример: GET /admin/metrics [{"id":"cpu","type":"gauge","value":0.7},{"id":"cpu","type":"gauge","value":0.2,"tenant":"team-a"}]
+func GetAllMetrics(svc metrics.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		items, err := svc.ListAll(r.Context())
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(items)
+	}
+}
+
 // Ping возвращает HTTP-обработчик для проверки доступности сервера.
 // Проверяет подключение к базе данных (если используется) и возвращает статус.
 func Ping(svc metrics.Service) http.HandlerFunc {
@@ -155,3 +174,77 @@ func Ping(svc metrics.Service) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 	}
 }
+
+// GetTargets возвращает HTTP-обработчик со списком целей опроса и их состоянием.
+// Пример: GET /targets [{"url":"http://host:9101/metrics","health":"up","samples":35}]
+func GetTargets(scraper *scrape.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(scraper.Status())
+	}
+}
+
+// GetAgents возвращает HTTP-обработчик со списком агентов, отправлявших метрики.
+// Пример: GET /agents [{"id":"3f2a...","hostname":"web-1","version":"v1.2.0","reports":42,"errors":0,...}]
+func GetAgents(inv *inventory.Inventory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(inv.List())
+	}
+}
+
+// maxConfigWait ограничивает ожидание изменений, чтобы уложиться в таймаут запроса сервера
+const maxConfigWait = 50 * time.Second
+
+// GetAgentConfig возвращает HTTP-обработчик с настройками агента.
+// Агент определяется по заголовкам X-Agent-ID и X-Agent-Group, версия настроек передается в ETag.
+// При совпадении If-None-Match и параметре wait запрос ждет изменения настроек до wait,
+// после чего отвечает 304.
+// Пример: GET /agent-config?wait=30s
+func GetAgentConfig(store *remoteconfig.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var wait time.Duration
+		if v := r.URL.Query().Get("wait"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				WriteError(w, domain.ErrInvalidPayload)
+				return
+			}
+			wait = min(d, maxConfigWait)
+		}
+
+		id := r.Header.Get(identity.HeaderID)
+		group := r.Header.Get(identity.HeaderGroup)
+		known := r.Header.Get("If-None-Match")
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		for {
+			changed := store.Changed()
+			doc := store.Resolve(id, group)
+			etag := doc.ETag()
+
+			if etag != known {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", etag)
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(doc)
+				return
+			}
+
+			select {
+			case <-changed:
+				continue
+			case <-timer.C:
+			case <-r.Context().Done():
+			}
+
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+}
@@ -0,0 +1,9 @@
+-- Токены доступа к API, хранится только SHA-256 значения
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
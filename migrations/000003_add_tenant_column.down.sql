@@ -0,0 +1,13 @@
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS tenant;
+
+-- Метрики арендаторов, кроме арендатора по умолчанию, удаляются: без tenant их имена могут совпасть
+DELETE FROM praktikum WHERE tenant <> '';
+ALTER TABLE praktikum DROP CONSTRAINT IF EXISTS praktikum_pkey;
+ALTER TABLE praktikum ADD PRIMARY KEY (name);
+ALTER TABLE praktikum DROP COLUMN IF EXISTS tenant;
+
+DELETE FROM metrics WHERE tenant <> '';
+DROP INDEX IF EXISTS idx_metric_tenant;
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_pkey;
+ALTER TABLE metrics ADD PRIMARY KEY (name);
+ALTER TABLE metrics DROP COLUMN IF EXISTS tenant;
@@ -0,0 +1,13 @@
+-- Метрики разных арендаторов с одинаковым именем хранятся отдельно.
+-- Пустой tenant - арендатор по умолчанию, к нему относятся все существующие метрики.
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_pkey;
+ALTER TABLE metrics ADD PRIMARY KEY (tenant, name);
+CREATE INDEX IF NOT EXISTS idx_metric_tenant ON metrics(tenant);
+
+ALTER TABLE praktikum ADD COLUMN IF NOT EXISTS tenant VARCHAR(64) NOT NULL DEFAULT ''; -- Для тестов
+ALTER TABLE praktikum DROP CONSTRAINT IF EXISTS praktikum_pkey;
+ALTER TABLE praktikum ADD PRIMARY KEY (tenant, name);
+
+-- Токен может быть выдан одному арендатору, пустой tenant у токенов без арендатора
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS tenant VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,370 @@
+// Package apiclient - типизированный клиент HTTP API сервера метрик.
+//
+// Клиент сжимает тела запросов gzip, подписывает изменяющие запросы HMAC-SHA256 и (или) заголовком HashSHA256,
+// если заданы ключи, проверяет подпись ответа и возвращает ошибки сервера в виде *Error,
+// совместимого через errors.Is с ErrNotFound, ErrInvalidType, ErrInvalidPayload и ErrZeroCounter.
+package apiclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/domain"
+	"github.com/s0n1cAK/yandex-metrics/internal/hash"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
+	"github.com/s0n1cAK/yandex-metrics/internal/tenant"
+	"github.com/s0n1cAK/yandex-metrics/internal/tokens"
+)
+
+// Metric - метрика в формате JSON API сервера.
+type Metric = models.Metrics
+
+// Типы метрик
+const (
+	Counter = models.Counter
+	Gauge   = models.Gauge
+)
+
+// Ошибки сервера. Это те же значения, что и в пакете domain сервера.
+var (
+	ErrNotFound       = domain.ErrNotFound
+	ErrInvalidType    = domain.ErrInvalidType
+	ErrInvalidPayload = domain.ErrInvalidPayload
+	ErrZeroCounter    = domain.ErrZeroCounter
+	ErrQuotaExceeded  = domain.ErrQuotaExceeded
+)
+
+// ErrBadHash возвращается, если подпись ответа не совпала с ключом клиента.
+var ErrBadHash = errors.New("response hash mismatch")
+
+// Ошибки доступа: токен не задан, неизвестен или отозван; у токена нет нужной области.
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// ErrRateLimited возвращается, если клиент превысил ограничение частоты запросов сервера.
+// Повторить запрос можно через Error.RetryAfter.
+var ErrRateLimited = errors.New("rate limited")
+
+// knownErrors - ошибки, которые сервер возвращает текстом в теле ответа с кодом 400
+var knownErrors = []error{ErrInvalidType, ErrInvalidPayload, ErrZeroCounter, ErrNotFound, ErrQuotaExceeded}
+
+// Error - ответ сервера с кодом ошибки.
+type Error struct {
+	// StatusCode - HTTP-код ответа
+	StatusCode int
+	// Message - текст ответа сервера
+	Message string
+	// Err - ошибка домена, соответствующая ответу, или nil
+	Err error
+	// RetryAfter - пауза перед повтором из заголовка Retry-After, 0 если сервер ее не указал
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server responded %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("server responded %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Client выполняет запросы к серверу метрик.
+type Client struct {
+	// Address - адрес сервера, например http://localhost:8080
+	Address string
+	// Key - ключ подписи HashSHA256, пустой отключает подпись и ее проверку
+	Key string
+	// SignKeyID и SignKey - ключ подписи HMAC, известный серверу; пустой SignKey отключает подпись и ее проверку
+	SignKeyID string
+	SignKey   string
+	// Token - токен доступа Authorization: Bearer, пустой не передается
+	Token string
+	// Tenant - арендатор, метрики которого читает и пишет клиент; пустой - арендатор токена или по умолчанию
+	Tenant string
+	// HTTPClient - используемый HTTP-клиент, по умолчанию http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New создает клиента для сервера по адресу address.
+func New(address, key string) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &Client{
+		Address:    strings.TrimRight(address, "/"),
+		Key:        key,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// UpdateGauge устанавливает значение gauge через POST /update/gauge/{id}/{value}.
+func (c *Client) UpdateGauge(ctx context.Context, id string, value float64) error {
+	op := "apiclient.UpdateGauge"
+
+	if _, err := c.do(ctx, http.MethodPost, updatePath(Gauge, id, strconv.FormatFloat(value, 'f', -1, 64)), nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// UpdateCounter увеличивает счетчик через POST /update/counter/{id}/{delta}.
+func (c *Client) UpdateCounter(ctx context.Context, id string, delta int64) error {
+	op := "apiclient.UpdateCounter"
+
+	if _, err := c.do(ctx, http.MethodPost, updatePath(Counter, id, strconv.FormatInt(delta, 10)), nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Update обновляет метрику через POST /update и возвращает ответ сервера.
+func (c *Client) Update(ctx context.Context, m Metric) (Metric, error) {
+	op := "apiclient.Update"
+
+	var res Metric
+	if err := c.doJSON(ctx, "/update", m, &res); err != nil {
+		return Metric{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// UpdateBatch обновляет несколько метрик одним запросом POST /updates.
+func (c *Client) UpdateBatch(ctx context.Context, batch []Metric) error {
+	op := "apiclient.UpdateBatch"
+
+	if err := c.doJSON(ctx, "/updates", batch, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Get возвращает метрику через POST /value.
+func (c *Client) Get(ctx context.Context, mtype, id string) (Metric, error) {
+	op := "apiclient.Get"
+
+	var res Metric
+	if err := c.doJSON(ctx, "/value", Metric{ID: id, MType: mtype}, &res); err != nil {
+		return Metric{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// GetText возвращает значение метрики в текстовом виде через GET /value/{type}/{id}.
+func (c *Client) GetText(ctx context.Context, mtype, id string) (string, error) {
+	op := "apiclient.GetText"
+
+	body, err := c.do(ctx, http.MethodGet, "/value/"+url.PathEscape(mtype)+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return string(body), nil
+}
+
+// List возвращает идентификаторы всех метрик через GET /.
+func (c *Client) List(ctx context.Context) ([]string, error) {
+	op := "apiclient.List"
+
+	body, err := c.do(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var ids []string
+	if err := json.Unmarshal(body, &ids); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return ids, nil
+}
+
+// Ping проверяет доступность сервера и его хранилища через GET /ping.
+func (c *Client) Ping(ctx context.Context) error {
+	op := "apiclient.Ping"
+
+	if _, err := c.do(ctx, http.MethodGet, "/ping", nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func updatePath(mtype, id, value string) string {
+	return "/update/" + url.PathEscape(mtype) + "/" + url.PathEscape(id) + "/" + url.PathEscape(value)
+}
+
+// doJSON отправляет in в формате JSON и, если out не nil, разбирает в него ответ.
+func (c *Client) doJSON(ctx context.Context, path string, in, out any) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.do(ctx, http.MethodPost, path, payload)
+	if err != nil {
+		return err
+	}
+
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// do выполняет запрос и возвращает распакованное тело успешного ответа.
+func (c *Client) do(ctx context.Context, method, path string, payload []byte) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		body = &buf
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.Address+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept-Encoding", "gzip")
+	tokens.SetHeader(request.Header, c.Token)
+	if c.Tenant != "" {
+		request.Header.Set(tenant.Header, c.Tenant)
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	// Сервер требует подпись у всех изменяющих запросов, в том числе без тела
+	if method != http.MethodGet {
+		if c.Key != "" {
+			request.Header.Set("HashSHA256", hash.GetHashHex(bytes.Clone(payload), c.Key))
+		}
+		if c.SignKey != "" {
+			c.signer().Sign(request.Header, method, request.URL.Path, payload)
+		}
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := readBody(response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		e := newError(response.StatusCode, data)
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, e
+	}
+
+	if err := c.verify(response.Header, method, request.URL.Path, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (c *Client) signer() signing.Signer {
+	return signing.Signer{KeyID: c.SignKeyID, Key: c.SignKey}
+}
+
+// verify проверяет подпись тела ответа: HMAC, если задан SignKey, иначе HashSHA256, если задан Key.
+// Ответ без подписи отклоняется, иначе подмену ответа можно скрыть, убрав заголовок.
+func (c *Client) verify(header http.Header, method, path string, body []byte) error {
+	if c.SignKey != "" {
+		keys := signing.Keyring{c.SignKeyID: c.SignKey}
+		if err := signing.Check(keys, header, method, path, body); err != nil {
+			return fmt.Errorf("%w: %w", ErrBadHash, err)
+		}
+		return nil
+	}
+
+	if c.Key == "" {
+		return nil
+	}
+	if !strings.EqualFold(header.Get("HashSHA256"), hash.GetHashHex(body, c.Key)) {
+		return ErrBadHash
+	}
+	return nil
+}
+
+func readBody(response *http.Response) ([]byte, error) {
+	var reader io.Reader = response.Body
+
+	if strings.Contains(response.Header.Get("Content-Encoding"), "gzip") {
+		data, err := io.ReadAll(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		// Заголовок может прийти и с пустым телом, его нечего распаковывать
+		if len(data) == 0 {
+			return data, nil
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	return io.ReadAll(reader)
+}
+
+// newError сопоставляет ответ сервера с ошибкой домена.
+func newError(status int, body []byte) *Error {
+	message := strings.TrimSpace(string(body))
+	e := &Error{StatusCode: status, Message: message}
+
+	if status == http.StatusNotFound {
+		e.Err = ErrNotFound
+		return e
+	}
+
+	for _, known := range knownErrors {
+		if strings.Contains(message, known.Error()) {
+			e.Err = known
+			return e
+		}
+	}
+
+	switch status {
+	case http.StatusUnauthorized:
+		e.Err = ErrUnauthorized
+	case http.StatusForbidden:
+		e.Err = ErrForbidden
+	case http.StatusTooManyRequests:
+		e.Err = ErrRateLimited
+	}
+	return e
+}
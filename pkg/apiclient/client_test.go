@@ -0,0 +1,68 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_BadResponseHash(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("HashSHA256", "deadbeef")
+		w.Write([]byte(`{"id":"cpu","type":"gauge","value":1}`))
+	}))
+	defer ts.Close()
+
+	_, err := New(ts.URL, "secret").Get(context.Background(), Gauge, "cpu")
+	require.ErrorIs(t, err, ErrBadHash)
+}
+
+func TestClient_UnsignedResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Подпись запроса вместо подписи тела ответа
+		if got := r.Header.Get("HashSHA256"); got != "" {
+			w.Header().Set("HashSHA256", got)
+		}
+		w.Write([]byte(`{"id":"cpu","type":"gauge","value":1}`))
+	}))
+	defer ts.Close()
+
+	_, err := New(ts.URL, "secret").Get(context.Background(), Gauge, "cpu")
+	require.ErrorIs(t, err, ErrBadHash)
+
+	client := New(ts.URL, "")
+	client.SignKeyID, client.SignKey = "v1", "secret"
+	_, err = client.Get(context.Background(), Gauge, "cpu")
+	require.ErrorIs(t, err, ErrBadHash)
+
+	// Без ключей ответ не проверяется
+	_, err = New(ts.URL, "").Get(context.Background(), Gauge, "cpu")
+	require.NoError(t, err)
+}
+
+func TestClient_ContextCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := New(ts.URL, "").Ping(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewError(t *testing.T) {
+	e := newError(http.StatusBadRequest, []byte("invalid metric type\n"))
+	require.ErrorIs(t, e, ErrInvalidType)
+	require.Equal(t, "invalid metric type", e.Message)
+
+	e = newError(http.StatusInternalServerError, []byte("internal server error"))
+	require.Nil(t, e.Err)
+
+	require.ErrorIs(t, newError(http.StatusUnauthorized, []byte("unknown token")), ErrUnauthorized)
+	require.ErrorIs(t, newError(http.StatusForbidden, []byte(`token has no "write" scope`)), ErrForbidden)
+	require.ErrorIs(t, newError(http.StatusTooManyRequests, []byte("too many requests, retry later")), ErrRateLimited)
+}
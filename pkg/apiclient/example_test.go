@@ -0,0 +1,119 @@
+package apiclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	sconfig "github.com/s0n1cAK/yandex-metrics/internal/config/server"
+	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"github.com/s0n1cAK/yandex-metrics/internal/server"
+	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
+	"github.com/s0n1cAK/yandex-metrics/pkg/apiclient"
+	"go.uber.org/zap"
+)
+
+// newServer поднимает сервер метрик на httptest с ключом подписи key.
+func newServer(key string) (*httptest.Server, func()) {
+	dir, _ := os.MkdirTemp("", "apiclient")
+
+	cfg := &sconfig.Config{
+		Endpoint: customtype.Endpoint("http://localhost:8080"),
+		File:     filepath.Join(dir, "metrics.data"),
+		HashKey:  key,
+		Logger:   zap.NewNop(),
+	}
+
+	srv, err := server.New(cfg, memstorage.New())
+	if err != nil {
+		panic(err)
+	}
+
+	ts := httptest.NewServer(srv.Router)
+	return ts, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Example() {
+	ts, stop := newServer("secret")
+	defer stop()
+
+	ctx := context.Background()
+	client := apiclient.New(ts.URL, "secret")
+
+	if err := client.UpdateCounter(ctx, "requests", 3); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := client.UpdateGauge(ctx, "cpu", 0.75); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	delta := int64(2)
+	value := 512.5
+	err := client.UpdateBatch(ctx, []apiclient.Metric{
+		{ID: "requests", MType: apiclient.Counter, Delta: &delta},
+		{ID: "memory", MType: apiclient.Gauge, Value: &value},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	requests, err := client.Get(ctx, apiclient.Counter, "requests")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("requests:", *requests.Delta)
+
+	cpu, err := client.GetText(ctx, apiclient.Gauge, "cpu")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("cpu:", cpu)
+
+	// Output:
+	// requests: 5
+	// cpu: 0.75
+}
+
+func ExampleClient_Get_notFound() {
+	ts, stop := newServer("")
+	defer stop()
+
+	client := apiclient.New(ts.URL, "")
+
+	_, err := client.Get(context.Background(), apiclient.Gauge, "unknown")
+	fmt.Println(errors.Is(err, apiclient.ErrNotFound))
+
+	var apiErr *apiclient.Error
+	if errors.As(err, &apiErr) {
+		fmt.Println(apiErr.StatusCode)
+	}
+
+	// Output:
+	// true
+	// 404
+}
+
+func ExampleClient_Update() {
+	ts, stop := newServer("")
+	defer stop()
+
+	client := apiclient.New(ts.URL, "")
+
+	value := 1.5
+	_, err := client.Update(context.Background(), apiclient.Metric{ID: "requests", MType: "histogram", Value: &value})
+	fmt.Println(errors.Is(err, apiclient.ErrInvalidType))
+
+	// Output:
+	// true
+}
@@ -0,0 +1,214 @@
+// Package metricsclient позволяет отправлять метрики из любого Go-приложения на сервер метрик.
+//
+// Отправка использует тот же формат и механизмы, что и агент: пакетный POST /updates,
+// gzip, подпись HMAC или HashSHA256, шифрование, mTLS, повторы запросов и ограничение числа одновременных запросов.
+//
+//	client, err := metricsclient.New(metricsclient.Options{Address: "http://localhost:8080"})
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close(context.Background())
+//
+//	orders := client.Counter("orders_total")
+//	orders.Inc()
+//	client.Gauge("queue_size").Set(17)
+package metricsclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	config "github.com/s0n1cAK/yandex-metrics/internal/config/agent"
+	"github.com/s0n1cAK/yandex-metrics/internal/customtype"
+	"github.com/s0n1cAK/yandex-metrics/internal/service/agent"
+	memstorage "github.com/s0n1cAK/yandex-metrics/internal/storage/memStorage"
+	"go.uber.org/zap"
+)
+
+// Options - параметры клиента. Нулевые значения заменяются значениями агента по умолчанию.
+type Options struct {
+	// Address - адрес сервера, например http://localhost:8080, или несколько адресов через запятую
+	Address string
+	// Key - ключ подписи HashSHA256
+	Key string
+	// SignKeyID и SignKey - ключ подписи HMAC, пустой SignKey отключает подпись
+	SignKeyID string
+	SignKey   string
+	// CryptoKey - PEM-файл с открытым ключом сервера для шифрования запросов
+	CryptoKey string
+	// TLSCA - CA сервера, TLSCert и TLSKey - сертификат клиента для mTLS
+	TLSCA   string
+	TLSCert string
+	TLSKey  string
+	// TLSPin - SHA-256 сертификата сервера в hex
+	TLSPin string
+	// Token - токен доступа с областью write
+	Token string
+	// Tenant - арендатор на сервере
+	Tenant string
+	// ReportInterval - период отправки накопленных метрик
+	ReportInterval time.Duration
+	// RateLimit - максимальное число одновременных запросов к серверу
+	RateLimit int
+	// BatchSize - максимальное число метрик в одном запросе
+	BatchSize int
+	// Logger - логгер клиента, по умолчанию zap.NewNop()
+	Logger *zap.Logger
+}
+
+// Client накапливает значения метрик и периодически отправляет их на сервер.
+type Client struct {
+	agent   *agent.Agent
+	storage *memstorage.MemStorage
+	log     *zap.Logger
+
+	// reportMu не дает фоновой отправке и Flush отправить одни и те же значения дважды
+	reportMu sync.Mutex
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+	gauges   map[string]*Gauge
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New создает клиента и запускает фоновую отправку.
+func New(opts Options) (*Client, error) {
+	op := "metricsclient.New"
+
+	log := opts.Logger
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	cfg := config.Default(log)
+	// Клиент живет внутри чужого процесса и не должен создавать файлы в рабочем каталоге
+	cfg.AgentIDFile = ""
+
+	if opts.Address != "" {
+		var endpoints customtype.Endpoints
+		if err := endpoints.Set(opts.Address); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		cfg.Endpoints = endpoints
+	}
+	cfg.Hash = opts.Key
+	cfg.SignKeyID = opts.SignKeyID
+	cfg.SignKey = opts.SignKey
+	cfg.CryptoKey = opts.CryptoKey
+	cfg.TLSCA = opts.TLSCA
+	cfg.TLSCert = opts.TLSCert
+	cfg.TLSKey = opts.TLSKey
+	cfg.TLSPin = opts.TLSPin
+	cfg.Token = opts.Token
+	cfg.Tenant = opts.Tenant
+	if opts.ReportInterval > 0 {
+		cfg.ReportInterval = customtype.Time(opts.ReportInterval)
+	}
+	if opts.RateLimit > 0 {
+		cfg.RateLimit = opts.RateLimit
+	}
+	if opts.BatchSize > 0 {
+		cfg.BatchSize = opts.BatchSize
+	}
+
+	storage := memstorage.New()
+
+	a, err := agent.NewFromConfig(cfg, storage)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &Client{
+		agent:    a,
+		storage:  storage,
+		log:      log,
+		counters: make(map[string]*Counter),
+		gauges:   make(map[string]*Gauge),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go c.run(ctx, cfg.ReportInterval.Duration())
+
+	return c, nil
+}
+
+func (c *Client) run(ctx context.Context, interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				c.log.Error("Failed to report metrics", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Flush немедленно отправляет накопленные значения.
+// Значения, которые не удалось отправить, остаются до следующей отправки.
+func (c *Client) Flush(ctx context.Context) error {
+	c.reportMu.Lock()
+	defer c.reportMu.Unlock()
+
+	return c.agent.Report(ctx)
+}
+
+// Close останавливает фоновую отправку и отправляет оставшиеся значения.
+func (c *Client) Close(ctx context.Context) error {
+	c.cancel()
+	<-c.done
+	return c.Flush(ctx)
+}
+
+// Counter возвращает счетчик с именем name, создавая его при первом обращении.
+// На сервере у метрики один тип: для имени, уже занятого gauge, ошибка логируется
+// и возвращается счетчик, который ничего не отправляет.
+func (c *Client) Counter(name string) *Counter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.gauges[name]; ok {
+		c.log.Error("Metric is already registered as gauge, counter is ignored", zap.String("name", name))
+		return &Counter{name: name}
+	}
+
+	counter, ok := c.counters[name]
+	if !ok {
+		counter = &Counter{name: name, client: c}
+		c.counters[name] = counter
+	}
+	return counter
+}
+
+// Gauge возвращает gauge с именем name, создавая его при первом обращении.
+// На сервере у метрики один тип: для имени, уже занятого счетчиком, ошибка логируется
+// и возвращается gauge, который ничего не отправляет.
+func (c *Client) Gauge(name string) *Gauge {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.counters[name]; ok {
+		c.log.Error("Metric is already registered as counter, gauge is ignored", zap.String("name", name))
+		return &Gauge{name: name}
+	}
+
+	gauge, ok := c.gauges[name]
+	if !ok {
+		gauge = &Gauge{name: name, client: c}
+		c.gauges[name] = gauge
+	}
+	return gauge
+}
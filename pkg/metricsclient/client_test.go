@@ -0,0 +1,170 @@
+package metricsclient
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/s0n1cAK/yandex-metrics/internal/hash"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"github.com/s0n1cAK/yandex-metrics/internal/signing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Flush(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []models.Metrics
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/updates", r.URL.Path)
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.Equal(t, hash.GetHashHex(body, "secret"), r.Header.Get("HashSHA256"))
+
+		var batch []models.Metrics
+		require.NoError(t, json.Unmarshal(body, &batch))
+
+		mu.Lock()
+		received = append(received, batch...)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	client, err := New(Options{Address: server.URL, Key: "secret", ReportInterval: time.Minute})
+	require.NoError(t, err)
+
+	orders := client.Counter("orders_total")
+	orders.Inc()
+	orders.Add(4)
+	require.Same(t, orders, client.Counter("orders_total"))
+
+	client.Gauge("queue_size").Set(3)
+	client.Gauge("queue_size").Set(17)
+
+	require.NoError(t, client.Flush(context.Background()))
+
+	mu.Lock()
+	got := make(map[string]models.Metrics)
+	for _, m := range received {
+		got[m.ID] = m
+	}
+	received = nil
+	mu.Unlock()
+
+	require.Len(t, got, 2)
+	require.Equal(t, int64(5), *got["orders_total"].Delta)
+	require.Equal(t, 17.0, *got["queue_size"].Value)
+
+	// Отправленные значения не уходят повторно
+	require.NoError(t, client.Close(context.Background()))
+	require.Empty(t, received)
+}
+
+func TestClient_GaugeSetDuringFlush(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		values []float64
+		client *Client
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var batch []models.Metrics
+		if err := json.NewDecoder(gz).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		for _, m := range batch {
+			values = append(values, *m.Value)
+		}
+		first := len(values) == 1
+		mu.Unlock()
+
+		// Новое значение записано, пока отправляется прежнее
+		if first {
+			client.Gauge("queue_size").Set(42)
+		}
+	}))
+	defer server.Close()
+
+	var err error
+	client, err = New(Options{Address: server.URL, ReportInterval: time.Minute})
+	require.NoError(t, err)
+
+	client.Gauge("queue_size").Set(3)
+	require.NoError(t, client.Flush(context.Background()))
+	require.NoError(t, client.Close(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []float64{3, 42}, values)
+}
+
+func TestClient_Signing(t *testing.T) {
+	keys := signing.Keyring{"v1": "secret"}
+	var checked atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+
+		if err := signing.Check(keys, r.Header, r.Method, r.URL.Path, body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		checked.Add(1)
+	}))
+	defer server.Close()
+
+	client, err := New(Options{Address: server.URL, SignKeyID: "v1", SignKey: "secret", ReportInterval: time.Minute})
+	require.NoError(t, err)
+	defer client.cancel()
+
+	client.Counter("orders_total").Inc()
+	require.NoError(t, client.Flush(context.Background()))
+	require.Equal(t, int32(1), checked.Load())
+
+	// Неверный путь к ключу шифрования - ошибка создания клиента, а не тихая отправка без шифрования
+	_, err = New(Options{Address: server.URL, CryptoKey: "missing.pem"})
+	require.Error(t, err)
+}
+
+func TestClient_TypeConflict(t *testing.T) {
+	client, err := New(Options{Address: "http://localhost:1"})
+	require.NoError(t, err)
+	defer client.cancel()
+
+	client.Counter("requests").Inc()
+	// Имя другого типа не роняет процесс, значения такой метрики отбрасываются
+	require.NotPanics(t, func() { client.Gauge("requests").Set(1) })
+	require.NotPanics(t, func() { client.Counter("requests").Inc() })
+
+	client.Gauge("queue_size")
+	require.NotPanics(t, func() { client.Counter("queue_size").Inc() })
+
+	all, err := client.storage.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, int64(2), *all["requests"].Delta)
+}
@@ -0,0 +1,58 @@
+package metricsclient
+
+import (
+	"github.com/s0n1cAK/yandex-metrics/internal/lib"
+	models "github.com/s0n1cAK/yandex-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// Counter - счетчик. Приращения суммируются до отправки, на сервер уходит сумма за период.
+type Counter struct {
+	name string
+	// client - nil у счетчика, имя которого занято gauge: его значения отбрасываются
+	client *Client
+}
+
+// Add увеличивает счетчик на delta.
+func (c *Counter) Add(delta int64) {
+	if delta == 0 || c.client == nil {
+		return
+	}
+
+	err := c.client.storage.Set(c.name, models.Metrics{
+		ID:    c.name,
+		MType: models.Counter,
+		Delta: lib.IntPtr(delta),
+	})
+	if err != nil {
+		c.client.log.Error("Failed to add counter", zap.String("name", c.name), zap.Error(err))
+	}
+}
+
+// Inc увеличивает счетчик на единицу.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Gauge - текущее значение. На сервер уходит последнее значение, установленное до отправки.
+type Gauge struct {
+	name string
+	// client - nil у gauge, имя которого занято счетчиком: его значения отбрасываются
+	client *Client
+}
+
+// Set устанавливает значение gauge.
+func (g *Gauge) Set(value float64) {
+	if g.client == nil {
+		return
+	}
+
+	err := g.client.storage.Set(g.name, models.Metrics{
+		ID:    g.name,
+		MType: models.Gauge,
+		Value: lib.FloatPtr(value),
+	})
+	if err != nil {
+		g.client.log.Error("Failed to set gauge", zap.String("name", g.name), zap.Error(err))
+	}
+}